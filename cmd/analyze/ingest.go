@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/logger/logging"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	//lint:ignore SA1019 the pubsub protobuf tracer writes this format
+	"github.com/libp2p/go-msgio/protoio"
+)
+
+// logTimeLayout is the timestamp layout of the node log files
+const logTimeLayout = "2006-01-02T15:04:05.000Z0700"
+
+// maxLineSize is the longest log line or trace record that is read
+const maxLineSize = 16 * 1024 * 1024
+
+// Log messages of the chain that mark blocks being published and accepted by a node
+var (
+	publishedBlockRe = regexp.MustCompile(`^(?:compact )?block published successfully: index: (\d+), .*hash: ([0-9a-f]+)$`)
+	acceptedBlockRe  = regexp.MustCompile(`^block accepted into chain: index (\d+), hash: ([0-9a-f]+)$`)
+)
+
+// eventType is the kind of an observation made by a node
+type eventType int
+
+const (
+	evPublish   eventType = iota // The node published a message or block
+	evDeliver                    // The node received a message for the first time
+	evDuplicate                  // The node received a message it already had
+	evAccept                     // The node added a block to its chain
+)
+
+// event is a single observation of a message or block by a node
+type event struct {
+	Node      string // Peer ID of the observing node
+	Type      eventType
+	Time      time.Time
+	MessageID string // Hex pubsub message ID, empty for chain events
+	Topic     string
+	From      string // Peer the message was received from
+	Kind      string // Content of the message, e.g., "tx", "BLOCK", "CMPCT"
+	Hash      string // Hex hash of the carried block or transaction
+	Index     uint64 // Index of the carried block
+	Traced    bool   // Whether the event came from a pubsub trace instead of the debug log
+}
+
+// dataset holds all observations loaded from the input files
+type dataset struct {
+	events  []event
+	records map[string]logging.MessageRecord // Message ID correlations by hex message ID
+	traced  map[string]bool                  // Nodes with pubsub trace events
+	skipped int                              // Lines that could not be parsed
+}
+
+// logEntry is a line of a node log file
+type logEntry struct {
+	TS           string `json:"ts"`
+	Logger       string `json:"logger"`
+	Msg          string `json:"msg"`
+	PeerID       string `json:"peerID"`
+	MessageID    string `json:"messageID"`
+	Topic        string `json:"topic"`
+	ReceivedFrom string `json:"receivedFrom"`
+}
+
+// newDataset creates an empty dataset
+func newDataset() *dataset {
+	return &dataset{
+		records: make(map[string]logging.MessageRecord),
+		traced:  make(map[string]bool),
+	}
+}
+
+// load reads the file, or all known node files below the directory
+func (ds *dataset) load(path string) error {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return ds.loadFile(path)
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !isNodeFile(d.Name()) {
+			return nil
+		}
+
+		return ds.loadFile(p)
+	})
+}
+
+// isNodeFile reports whether the file name is one of the files written by a node
+func isNodeFile(name string) bool {
+	if name == "log.jsonl" {
+		return true
+	}
+
+	return strings.HasPrefix(name, "trace") && (strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".pb"))
+}
+
+// loadFile reads a protobuf trace or a JSON lines file
+func (ds *dataset) loadFile(path string) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".pb") {
+		return ds.loadPBTrace(f)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		if err := ds.loadLine(scanner.Bytes()); err != nil {
+			ds.skipped++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// loadPBTrace reads delimited protobuf trace events
+func (ds *dataset) loadPBTrace(r io.Reader) error {
+	reader := protoio.NewDelimitedReader(r, maxLineSize)
+
+	for {
+		var evt pb.TraceEvent
+
+		if err := reader.ReadMsg(&evt); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read trace event: %v", err)
+		}
+
+		ds.addTraceEvent(&evt)
+	}
+}
+
+// loadLine recognizes a log entry, a trace event or a message correlation record
+func (ds *dataset) loadLine(line []byte) error {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return err
+	}
+
+	switch {
+	case fields["logger"] != nil:
+		var entry logEntry
+
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+
+		return ds.addLogEntry(&entry)
+	case fields["kind"] != nil:
+		var record logging.MessageRecord
+
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+
+		ds.records[hex.EncodeToString(record.MessageID)] = record
+
+		return nil
+	case fields["timestamp"] != nil:
+		var evt pb.TraceEvent
+
+		if err := json.Unmarshal(line, &evt); err != nil {
+			return err
+		}
+
+		ds.addTraceEvent(&evt)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown record")
+	}
+}
+
+// addLogEntry records gossipsub debug events and block publish and accept messages of a node log
+func (ds *dataset) addLogEntry(entry *logEntry) error {
+	ts, err := time.Parse(logTimeLayout, entry.TS)
+
+	if err != nil {
+		return err
+	}
+
+	evt := event{Node: entry.PeerID, Time: ts}
+
+	if entry.Logger == "gossipsub" {
+		switch entry.Msg {
+		case "publish message":
+			evt.Type = evPublish
+		case "deliver message":
+			evt.Type = evDeliver
+		case "duplicate message":
+			evt.Type = evDuplicate
+		default:
+			return nil
+		}
+
+		evt.MessageID = entry.MessageID
+		evt.Topic = entry.Topic
+		evt.From = entry.ReceivedFrom
+
+		ds.events = append(ds.events, evt)
+
+		return nil
+	}
+
+	if m := publishedBlockRe.FindStringSubmatch(entry.Msg); m != nil {
+		evt.Type = evPublish
+		evt.Index, _ = strconv.ParseUint(m[1], 10, 64)
+		evt.Hash = m[2]
+	} else if m := acceptedBlockRe.FindStringSubmatch(entry.Msg); m != nil {
+		evt.Type = evAccept
+		evt.Index, _ = strconv.ParseUint(m[1], 10, 64)
+		evt.Hash = m[2]
+	} else {
+		return nil
+	}
+
+	evt.Kind = "BLOCK"
+
+	ds.events = append(ds.events, evt)
+
+	return nil
+}
+
+// addTraceEvent records publish, deliver and duplicate trace events
+func (ds *dataset) addTraceEvent(te *pb.TraceEvent) {
+	node := peerString(te.PeerID)
+	evt := event{Node: node, Time: time.Unix(0, te.GetTimestamp()), Traced: true}
+
+	switch te.GetType() {
+	case pb.TraceEvent_PUBLISH_MESSAGE:
+		evt.Type = evPublish
+		evt.MessageID = hex.EncodeToString(te.PublishMessage.GetMessageID())
+		evt.Topic = te.PublishMessage.GetTopic()
+	case pb.TraceEvent_DELIVER_MESSAGE:
+		evt.Type = evDeliver
+		evt.MessageID = hex.EncodeToString(te.DeliverMessage.GetMessageID())
+		evt.Topic = te.DeliverMessage.GetTopic()
+		evt.From = peerString(te.DeliverMessage.GetReceivedFrom())
+	case pb.TraceEvent_DUPLICATE_MESSAGE:
+		evt.Type = evDuplicate
+		evt.MessageID = hex.EncodeToString(te.DuplicateMessage.GetMessageID())
+		evt.Topic = te.DuplicateMessage.GetTopic()
+		evt.From = peerString(te.DuplicateMessage.GetReceivedFrom())
+	default:
+		return
+	}
+
+	ds.traced[node] = true
+	ds.events = append(ds.events, evt)
+}
+
+// resolve prefers trace events over debug log events of the same node, attaches message correlations
+// and orders all events by time
+func (ds *dataset) resolve() {
+	events := ds.events[:0]
+
+	for _, evt := range ds.events {
+		if evt.MessageID != "" && !evt.Traced && ds.traced[evt.Node] {
+			continue
+		}
+
+		if record, ok := ds.records[evt.MessageID]; ok && evt.MessageID != "" {
+			evt.Kind = record.Kind
+			evt.Hash = record.Hash
+			evt.Index = record.Index
+		}
+
+		events = append(events, evt)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	ds.events = events
+
+	if ds.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d unrecognized lines\n", ds.skipped)
+	}
+}
+
+// peerString returns the string form of a binary peer ID
+func peerString(b []byte) string {
+	id, err := peer.IDFromBytes(b)
+
+	if err != nil {
+		return hex.EncodeToString(b)
+	}
+
+	return id.String()
+}
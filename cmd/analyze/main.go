@@ -0,0 +1,75 @@
+// Command analyze reports block and transaction propagation metrics from the logs and traces of many nodes.
+//
+// Usage:
+//
+//	analyze [-report all|summary|blocks|forks|peers] [-format table|csv] <file or directory>...
+//
+// Directories are searched recursively for log.jsonl, trace.jsonl, trace.pb and trace-ids.jsonl files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	report := flag.String("report", "all", "report to print: all, summary, blocks, forks, peers")
+	format := flag.String("format", "table", "output format: table, csv")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <file or directory>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ds := newDataset()
+
+	for _, path := range flag.Args() {
+		if err := ds.load(path); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+
+	ds.resolve()
+
+	out, err := newWriter(os.Stdout, *format)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	a := analyze(ds)
+
+	switch *report {
+	case "all":
+		a.writeSummary(out)
+		a.writeBlocks(out)
+		a.writeForks(out)
+		a.writePeers(out)
+	case "summary":
+		a.writeSummary(out)
+	case "blocks":
+		a.writeBlocks(out)
+	case "forks":
+		a.writeForks(out)
+	case "peers":
+		a.writePeers(out)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown report: %s\n", *report)
+		os.Exit(2)
+	}
+
+	if err := out.flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write report: %v\n", err)
+		os.Exit(1)
+	}
+}
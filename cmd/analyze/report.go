@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// blockStats is the propagation of a single block through the network
+type blockStats struct {
+	Hash      string
+	Index     uint64
+	Origin    string    // Node that published the block
+	Published time.Time // Earliest publish, or earliest arrival if no publish was observed
+	Arrivals  map[string]time.Time
+	Latencies []time.Duration // Arrival delays at all other nodes
+}
+
+// forkStats lists the competing blocks of a height
+type forkStats struct {
+	Index     uint64
+	Hashes    int
+	Canonical string
+	Orphans   []string
+}
+
+// peerStats is the contribution of a peer to message propagation
+type peerStats struct {
+	Peer       string
+	First      int // Messages this peer delivered first to a node
+	Duplicates int // Messages this peer sent that the node already had
+}
+
+// topicStats counts the messages and their copies on a topic
+type topicStats struct {
+	Topic      string
+	Published  int
+	Deliveries int
+	Duplicates int
+}
+
+// analysis holds the metrics computed from a dataset
+type analysis struct {
+	nodes  map[string]bool
+	blocks []*blockStats
+	forks  []*forkStats
+	peers  []*peerStats
+	topics []*topicStats
+
+	txCount     int
+	txLatencies []time.Duration
+	totalHashes int // Distinct block hashes with a known index
+	orphans     int
+}
+
+// analyze computes the propagation, duplicate, fork and peer metrics of the dataset
+func analyze(ds *dataset) *analysis {
+	a := &analysis{nodes: make(map[string]bool)}
+
+	blocks := make(map[string]*blockStats)
+	txs := make(map[string]*blockStats)
+	peers := make(map[string]*peerStats)
+	topics := make(map[string]*topicStats)
+
+	// Last block each node held at each height, used to pick the canonical block
+	held := make(map[string]map[uint64]string)
+
+	for _, evt := range ds.events {
+		if evt.Node != "" {
+			a.nodes[evt.Node] = true
+		}
+
+		if evt.Topic != "" {
+			ts := topics[evt.Topic]
+
+			if ts == nil {
+				ts = &topicStats{Topic: evt.Topic}
+				topics[evt.Topic] = ts
+			}
+
+			switch evt.Type {
+			case evPublish:
+				ts.Published++
+			case evDeliver:
+				ts.Deliveries++
+			case evDuplicate:
+				ts.Duplicates++
+			}
+		}
+
+		if evt.From != "" && (evt.Type == evDeliver || evt.Type == evDuplicate) {
+			ps := peers[evt.From]
+
+			if ps == nil {
+				ps = &peerStats{Peer: evt.From}
+				peers[evt.From] = ps
+			}
+
+			if evt.Type == evDeliver {
+				ps.First++
+			} else {
+				ps.Duplicates++
+			}
+		}
+
+		if evt.Hash == "" || evt.Type == evDuplicate {
+			continue
+		}
+
+		var set map[string]*blockStats
+
+		switch evt.Kind {
+		case "BLOCK", "CMPCT":
+			set = blocks
+		case "tx":
+			set = txs
+		default:
+			continue
+		}
+
+		bs := set[evt.Hash]
+
+		if bs == nil {
+			bs = &blockStats{Hash: evt.Hash, Index: evt.Index, Arrivals: make(map[string]time.Time)}
+			set[evt.Hash] = bs
+		}
+
+		if evt.Type == evPublish {
+			if bs.Origin == "" || evt.Time.Before(bs.Published) {
+				bs.Origin = evt.Node
+				bs.Published = evt.Time
+			}
+		} else if t, ok := bs.Arrivals[evt.Node]; !ok || evt.Time.Before(t) {
+			bs.Arrivals[evt.Node] = evt.Time
+		}
+
+		if evt.Kind != "tx" && (evt.Type == evPublish || evt.Type == evAccept) {
+			if held[evt.Node] == nil {
+				held[evt.Node] = make(map[uint64]string)
+			}
+
+			held[evt.Node][evt.Index] = evt.Hash
+		}
+	}
+
+	for _, bs := range blocks {
+		computeLatencies(bs)
+		a.blocks = append(a.blocks, bs)
+	}
+
+	a.txCount = len(txs)
+
+	for _, bs := range txs {
+		computeLatencies(bs)
+		a.txLatencies = append(a.txLatencies, bs.Latencies...)
+	}
+
+	for _, ps := range peers {
+		a.peers = append(a.peers, ps)
+	}
+
+	for _, ts := range topics {
+		a.topics = append(a.topics, ts)
+	}
+
+	sort.Slice(a.blocks, func(i, j int) bool {
+		if a.blocks[i].Index != a.blocks[j].Index {
+			return a.blocks[i].Index < a.blocks[j].Index
+		}
+
+		return a.blocks[i].Published.Before(a.blocks[j].Published)
+	})
+
+	sort.Slice(a.peers, func(i, j int) bool {
+		return a.peers[i].First > a.peers[j].First
+	})
+
+	sort.Slice(a.topics, func(i, j int) bool {
+		return a.topics[i].Topic < a.topics[j].Topic
+	})
+
+	a.findForks(held)
+
+	return a
+}
+
+// computeLatencies measures the arrival delay at every node other than the origin
+func computeLatencies(bs *blockStats) {
+	if bs.Origin == "" {
+		for node, t := range bs.Arrivals {
+			if bs.Origin == "" || t.Before(bs.Published) {
+				bs.Origin = node
+				bs.Published = t
+			}
+		}
+	}
+
+	for node, t := range bs.Arrivals {
+		if node == bs.Origin {
+			continue
+		}
+
+		bs.Latencies = append(bs.Latencies, t.Sub(bs.Published))
+	}
+
+	sort.Slice(bs.Latencies, func(i, j int) bool {
+		return bs.Latencies[i] < bs.Latencies[j]
+	})
+}
+
+// findForks groups blocks by height and picks the block held by most nodes as canonical
+func (a *analysis) findForks(held map[string]map[uint64]string) {
+	heights := make(map[uint64][]*blockStats)
+
+	for _, bs := range a.blocks {
+		heights[bs.Index] = append(heights[bs.Index], bs)
+	}
+
+	a.totalHashes = len(a.blocks)
+
+	for index, candidates := range heights {
+		if len(candidates) < 2 {
+			continue
+		}
+
+		votes := make(map[string]int)
+
+		for _, h := range held {
+			if hash, ok := h[index]; ok {
+				votes[hash]++
+			}
+		}
+
+		// Without chain events, the block that reached the most nodes wins
+		if len(votes) == 0 {
+			for _, bs := range candidates {
+				votes[bs.Hash] = len(bs.Arrivals)
+			}
+		}
+
+		fs := &forkStats{Index: index, Hashes: len(candidates)}
+
+		for _, bs := range candidates {
+			if fs.Canonical == "" || votes[bs.Hash] > votes[fs.Canonical] {
+				fs.Canonical = bs.Hash
+			}
+		}
+
+		for _, bs := range candidates {
+			if bs.Hash != fs.Canonical {
+				fs.Orphans = append(fs.Orphans, bs.Hash)
+			}
+		}
+
+		a.orphans += len(fs.Orphans)
+		a.forks = append(a.forks, fs)
+	}
+
+	sort.Slice(a.forks, func(i, j int) bool {
+		return a.forks[i].Index < a.forks[j].Index
+	})
+}
+
+// writeSummary prints network-wide propagation, duplicate and fork metrics
+func (a *analysis) writeSummary(out *writer) {
+	var blockLatencies []time.Duration
+
+	for _, bs := range a.blocks {
+		blockLatencies = append(blockLatencies, bs.Latencies...)
+	}
+
+	sort.Slice(blockLatencies, func(i, j int) bool {
+		return blockLatencies[i] < blockLatencies[j]
+	})
+
+	sort.Slice(a.txLatencies, func(i, j int) bool {
+		return a.txLatencies[i] < a.txLatencies[j]
+	})
+
+	out.section("Summary", "metric", "value")
+
+	out.row("nodes", strconv.Itoa(len(a.nodes)))
+	out.row("blocks", strconv.Itoa(len(a.blocks)))
+	out.row("block_latency_p50_ms", millis(percentile(blockLatencies, 50)))
+	out.row("block_latency_p90_ms", millis(percentile(blockLatencies, 90)))
+	out.row("block_latency_p99_ms", millis(percentile(blockLatencies, 99)))
+	out.row("txs", strconv.Itoa(a.txCount))
+	out.row("tx_latency_p50_ms", millis(percentile(a.txLatencies, 50)))
+	out.row("tx_latency_p90_ms", millis(percentile(a.txLatencies, 90)))
+	out.row("tx_latency_p99_ms", millis(percentile(a.txLatencies, 99)))
+	out.row("fork_heights", strconv.Itoa(len(a.forks)))
+	out.row("orphan_rate", ratio(a.orphans, a.totalHashes))
+
+	for _, ts := range a.topics {
+		out.row("duplicate_ratio:"+ts.Topic, ratio(ts.Duplicates, ts.Deliveries))
+	}
+}
+
+// writeBlocks prints the propagation latency percentiles of every block
+func (a *analysis) writeBlocks(out *writer) {
+	out.section("Block propagation", "index", "hash", "origin", "nodes", "p50_ms", "p90_ms", "p99_ms", "max_ms")
+
+	for _, bs := range a.blocks {
+		out.row(
+			strconv.FormatUint(bs.Index, 10),
+			bs.Hash,
+			bs.Origin,
+			strconv.Itoa(len(bs.Latencies)),
+			millis(percentile(bs.Latencies, 50)),
+			millis(percentile(bs.Latencies, 90)),
+			millis(percentile(bs.Latencies, 99)),
+			millis(percentile(bs.Latencies, 100)),
+		)
+	}
+}
+
+// writeForks prints the heights with competing blocks
+func (a *analysis) writeForks(out *writer) {
+	out.section("Forks", "index", "blocks", "canonical", "orphans")
+
+	for _, fs := range a.forks {
+		out.row(strconv.FormatUint(fs.Index, 10), strconv.Itoa(fs.Hashes), fs.Canonical, strings.Join(fs.Orphans, " "))
+	}
+}
+
+// writePeers prints how many first deliveries and duplicates each peer contributed
+func (a *analysis) writePeers(out *writer) {
+	total := 0
+
+	for _, ps := range a.peers {
+		total += ps.First
+	}
+
+	out.section("Peer contribution", "peer", "first_deliveries", "share", "duplicates", "duplicate_ratio")
+
+	for _, ps := range a.peers {
+		out.row(ps.Peer, strconv.Itoa(ps.First), ratio(ps.First, total), strconv.Itoa(ps.Duplicates), ratio(ps.Duplicates, ps.First))
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return -1
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// millis formats a duration in milliseconds, or "-" if unknown
+func millis(d time.Duration) string {
+	if d < 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64)
+}
+
+// ratio formats n/d, or "-" if d is zero
+func ratio(n, d int) string {
+	if d == 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(float64(n)/float64(d), 'f', 3, 64)
+}
+
+// writer prints report sections as aligned tables or CSV
+type writer struct {
+	w        io.Writer
+	table    *tabwriter.Writer
+	csv      *csv.Writer
+	sections int
+}
+
+// newWriter creates a report writer for the format
+func newWriter(w io.Writer, format string) (*writer, error) {
+	switch format {
+	case "table":
+		return &writer{w: w, table: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}, nil
+	case "csv":
+		return &writer{w: w, csv: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// section starts a new report section with the given column names
+func (w *writer) section(title string, header ...string) {
+	if w.table != nil {
+		w.table.Flush()
+
+		if w.sections > 0 {
+			fmt.Fprintln(w.w)
+		}
+
+		fmt.Fprintf(w.w, "== %s ==\n", title)
+	} else if w.sections > 0 {
+		w.csv.Flush()
+		fmt.Fprintln(w.w)
+	}
+
+	w.sections++
+	w.row(header...)
+}
+
+// row prints a row of the current section
+func (w *writer) row(fields ...string) {
+	if w.table != nil {
+		fmt.Fprintln(w.table, strings.Join(fields, "\t"))
+	} else {
+		w.csv.Write(fields)
+	}
+}
+
+// flush writes any buffered output
+func (w *writer) flush() error {
+	if w.table != nil {
+		return w.table.Flush()
+	}
+
+	w.csv.Flush()
+
+	return w.csv.Error()
+}
@@ -4,27 +4,145 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/elecbug/lab-chain/internal/logger"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	LogLevel string        `yaml:"log_level"`
-	Mode     string        `yaml:"mode"` // e.g., "full", "light", "boot"
-	Network  NetworkConfig `yaml:"network"`
-	DHT      DHTConfig     `yaml:"dht"`
+	LogLevel  string          `yaml:"log_level"`
+	Mode      string          `yaml:"mode"`     // e.g., "full", "light", "boot"
+	DataDir   string          `yaml:"data_dir"` // Directory for keys, logs and node state
+	Network   NetworkConfig   `yaml:"network"`
+	DHT       DHTConfig       `yaml:"dht"`
+	MDNS      MDNSConfig      `yaml:"mdns"`
+	NAT       NATConfig       `yaml:"nat"`
+	PeerStore PeerStoreConfig `yaml:"peerstore"`
+	PubSub    PubSubConfig    `yaml:"pubsub"`
+	Relay     RelayConfig     `yaml:"relay"`
+	Mempool   MempoolConfig   `yaml:"mempool"`
+	Ban       BanConfig       `yaml:"ban"`
 }
 
 type NetworkConfig struct {
-	IPAddress string `yaml:"ip_address"`
-	MaxPeers  int    `yaml:"max_peers"` // Maximum number of peers to connect to
+	ID            string   `yaml:"id"`        // Network ID namespacing topics, DHT and stream protocols
+	SwarmKey      string   `yaml:"swarm_key"` // Path to a pre-shared key file for a private network (optional)
+	IPAddress     string   `yaml:"ip_address"`
+	MaxPeers      int      `yaml:"max_peers"`      // Maximum number of peers to connect to
+	ListenAddrs   []string `yaml:"listen_addrs"`   // Multiaddrs to listen on, defaults to TCP port 12000 on ip_address
+	AnnounceAddrs []string `yaml:"announce_addrs"` // Multiaddrs advertised to peers instead of the listen addresses
+	Transports    []string `yaml:"transports"`     // Enabled transports: "tcp", "quic", "ws"
+
+	ConnManager ConnManagerConfig `yaml:"conn_manager"`
+}
+
+type ConnManagerConfig struct {
+	LowWater    int           `yaml:"low_water"`    // Number of connections kept when trimming
+	HighWater   int           `yaml:"high_water"`   // Number of connections that triggers trimming
+	GracePeriod time.Duration `yaml:"grace_period"` // Time new connections are exempt from trimming, e.g., "30s"
+}
+
+// Topic returns the pubsub topic name namespaced by the network ID
+func (n NetworkConfig) Topic(name string) string {
+	return fmt.Sprintf("%s-%s", n.ID, name)
+}
+
+// Protocol returns the stream protocol ID namespaced by the network ID
+func (n NetworkConfig) Protocol(name, version string) protocol.ID {
+	return protocol.ID(fmt.Sprintf("/%s/%s/%s", n.ID, name, version))
 }
 
 type DHTConfig struct {
-	Mode           string   `yaml:"mode"`            // e.g., "server", "client"
-	BootstrapPeers []string `yaml:"bootstrap_peers"` // List of bootstrap peers for DHT
+	Mode              string        `yaml:"mode"`               // e.g., "server", "client"
+	BootstrapPeers    []string      `yaml:"bootstrap_peers"`    // List of bootstrap peers for DHT
+	DiscoveryInterval time.Duration `yaml:"discovery_interval"` // Interval between rendezvous peer searches, e.g., "1m"
+}
+
+type MDNSConfig struct {
+	Enabled    bool   `yaml:"enabled"`     // Discover peers on the local network via mDNS
+	ServiceTag string `yaml:"service_tag"` // Service tag announced and searched for via mDNS, defaults to the network ID
+}
+
+type NATConfig struct {
+	RelayService bool     `yaml:"relay_service"` // Serve as a circuit relay v2 for peers behind NAT, e.g., on boot nodes
+	RelayClient  bool     `yaml:"relay_client"`  // Reserve slots on relays and advertise relayed addresses when not publicly reachable
+	StaticRelays []string `yaml:"static_relays"` // Relay multiaddrs with peer ID, defaults to the bootstrap peers
+	AutoNAT      bool     `yaml:"autonat"`       // Answer reachability checks of peers
+	HolePunching bool     `yaml:"hole_punching"` // Upgrade relayed connections to direct ones via DCUtR
+	PortMap      bool     `yaml:"port_map"`      // Open ports on the gateway via UPnP or NAT-PMP
+	Reachability string   `yaml:"reachability"`  // Override detected reachability: "public", "private", empty to detect
+}
+
+type PeerStoreConfig struct {
+	File       string        `yaml:"file"`        // Address book of known peers, defaults to peers.json in the data directory
+	Redial     int           `yaml:"redial"`      // Number of best known peers dialed at startup, defaults to the connection manager low water
+	MaxAge     time.Duration `yaml:"max_age"`     // Automatically learned peers not seen for this long are forgotten, e.g., "168h"
+	MaxRecords int           `yaml:"max_records"` // Maximum number of known peers kept
+}
+
+type PubSubConfig struct {
+	Router    string          `yaml:"router"` // e.g., "gossipsub", "floodsub", "randomsub"
+	GossipSub GossipSubConfig `yaml:"gossipsub"`
+	Score     ScoreConfig     `yaml:"score"`
+	Trace     TraceConfig     `yaml:"trace"`
+}
+
+type GossipSubConfig struct {
+	D                 int           `yaml:"d"`                  // Target number of mesh peers per topic
+	Dlo               int           `yaml:"d_lo"`               // Lower bound of mesh peers before grafting
+	Dhi               int           `yaml:"d_hi"`               // Upper bound of mesh peers before pruning
+	Dlazy             int           `yaml:"d_lazy"`             // Number of peers to emit gossip to per heartbeat
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // Time between heartbeats, e.g., "1s"
+	HistoryLength     int           `yaml:"history_length"`     // Number of heartbeats messages are cached for
+	HistoryGossip     int           `yaml:"history_gossip"`     // Number of heartbeats whose messages are advertised in gossip
+	FloodPublish      *bool         `yaml:"flood_publish"`      // Publish own messages to all peers above the publish threshold
+}
+
+type ScoreConfig struct {
+	Enabled               bool    `yaml:"enabled"`
+	BlockTopicWeight      float64 `yaml:"block_topic_weight"`      // Weight of the block topic in the peer score
+	TxTopicWeight         float64 `yaml:"tx_topic_weight"`         // Weight of the transaction topic in the peer score
+	InvalidMessageWeight  float64 `yaml:"invalid_message_weight"`  // Penalty per squared invalid message, must be negative
+	IPColocationWeight    float64 `yaml:"ip_colocation_weight"`    // Penalty for peers sharing an IP, must be negative
+	IPColocationThreshold int     `yaml:"ip_colocation_threshold"` // Number of peers per IP before the penalty applies
+}
+
+type TraceConfig struct {
+	Enabled bool   `yaml:"enabled"`  // Export all pubsub trace events
+	Format  string `yaml:"format"`   // Trace file encoding: "json" for JSON lines, "pb" for delimited protobuf
+	File    string `yaml:"file"`     // Trace file, defaults to trace.jsonl or trace.pb in the data directory
+	IDsFile string `yaml:"ids_file"` // File mapping message IDs to block and transaction hashes, defaults to trace-ids.jsonl in the data directory
+	Remote  string `yaml:"remote"`   // Multiaddr with peer ID of a remote trace collector (optional)
+}
+
+type RelayConfig struct {
+	CompactBlocks bool   `yaml:"compact_blocks"` // Relay mined blocks as headers with short transaction IDs
+	TxMode        string `yaml:"tx_mode"`        // e.g., "flood" (gossipsub), "announce" (announce hashes, pull bodies)
+}
+
+type MempoolConfig struct {
+	PriceBump     int           `yaml:"price_bump"`      // Minimum price increase in percent to replace a transaction with the same sender and nonce
+	MaxTxs        int           `yaml:"max_txs"`         // Number of transactions kept, the lowest priced ones are evicted first
+	MaxPerAccount int           `yaml:"max_per_account"` // Number of transactions kept per sender
+	MinPrice      int64         `yaml:"min_price"`       // Minimum price of transactions accepted and relayed
+	Lifetime      time.Duration `yaml:"lifetime"`        // Time after which transactions that were not mined are evicted, e.g., "3h"
+	Journal       string        `yaml:"journal"`         // File keeping locally submitted transactions across restarts, defaults to mempool.jsonl in the data directory
+	Fee           FeeConfig     `yaml:"fee"`
+}
+
+type FeeConfig struct {
+	History    int `yaml:"history"`    // Number of recent blocks the fee estimator looks at
+	Target     int `yaml:"target"`     // Number of blocks within which a transaction created without a price should be included
+	Confidence int `yaml:"confidence"` // Percentage of recent block windows in which the estimated price would have been included
+}
+
+type BanConfig struct {
+	Threshold int           `yaml:"threshold"` // Number of violations before a peer is banned
+	Duration  time.Duration `yaml:"duration"`  // How long a ban lasts, e.g., "10m"
 }
 
 // InitSetting initializes the configuration from the YAML file
@@ -39,7 +157,7 @@ func InitSetting() (*Config, *crypto.PrivKey, error) {
 		return nil, nil, fmt.Errorf("failed to set configuration: %v", err)
 	}
 
-	key, err := setKeyPair(*keyFile)
+	key, err := setKeyPair(config.DataDir, *keyFile)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to set key pair: %v", err)
@@ -67,17 +185,207 @@ func setConfig(cfgFile string) (*Config, error) {
 		return nil, fmt.Errorf("failed to decode YAML file into cfg.Config: %v", err)
 	}
 
+	setDefaults(&config)
+
 	log.Infof("Configuration loaded successfully from %s", cfgFile)
 
 	return &config, nil
 }
 
+// setDefaults fills in zero values of optional settings with their defaults
+func setDefaults(config *Config) {
+	if config.Network.ID == "" {
+		config.Network.ID = "lab-chain"
+	}
+
+	if config.DataDir == "" {
+		config.DataDir = "/app/data"
+	}
+
+	if len(config.Network.ListenAddrs) == 0 {
+		config.Network.ListenAddrs = []string{fmt.Sprintf("/ip4/%s/tcp/%d", config.Network.IPAddress, 12000)}
+	}
+
+	if len(config.Network.Transports) == 0 {
+		config.Network.Transports = []string{"tcp"}
+	}
+
+	cm := &config.Network.ConnManager
+
+	if cm.HighWater == 0 {
+		cm.HighWater = config.Network.MaxPeers * 9 / 10
+	}
+
+	if cm.LowWater == 0 {
+		cm.LowWater = config.Network.MaxPeers * 7 / 10
+	}
+
+	if cm.GracePeriod == 0 {
+		cm.GracePeriod = 30 * time.Second
+	}
+
+	ps := &config.PeerStore
+
+	if ps.File == "" {
+		ps.File = filepath.Join(config.DataDir, "peers.json")
+	}
+
+	if ps.Redial == 0 {
+		ps.Redial = cm.LowWater
+	}
+
+	if ps.MaxAge == 0 {
+		ps.MaxAge = 7 * 24 * time.Hour
+	}
+
+	if ps.MaxRecords == 0 {
+		ps.MaxRecords = 1000
+	}
+
+	if config.DHT.DiscoveryInterval == 0 {
+		config.DHT.DiscoveryInterval = time.Minute
+	}
+
+	if config.MDNS.ServiceTag == "" {
+		config.MDNS.ServiceTag = config.Network.ID
+	}
+
+	if len(config.NAT.StaticRelays) == 0 {
+		config.NAT.StaticRelays = config.DHT.BootstrapPeers
+	}
+
+	if config.Relay.TxMode == "" {
+		config.Relay.TxMode = "flood"
+	}
+
+	if config.PubSub.Router == "" {
+		config.PubSub.Router = "gossipsub"
+	}
+
+	gs := &config.PubSub.GossipSub
+
+	if gs.D == 0 {
+		gs.D = 6
+	}
+
+	if gs.Dlo == 0 {
+		gs.Dlo = 5
+	}
+
+	if gs.Dhi == 0 {
+		gs.Dhi = 12
+	}
+
+	if gs.Dlazy == 0 {
+		gs.Dlazy = 6
+	}
+
+	if gs.HeartbeatInterval == 0 {
+		gs.HeartbeatInterval = time.Second
+	}
+
+	if gs.HistoryLength == 0 {
+		gs.HistoryLength = 5
+	}
+
+	if gs.HistoryGossip == 0 {
+		gs.HistoryGossip = 3
+	}
+
+	if gs.FloodPublish == nil {
+		floodPublish := true
+		gs.FloodPublish = &floodPublish
+	}
+
+	trace := &config.PubSub.Trace
+
+	if trace.Format == "" {
+		trace.Format = "json"
+	}
+
+	if trace.File == "" {
+		if trace.Format == "pb" {
+			trace.File = filepath.Join(config.DataDir, "trace.pb")
+		} else {
+			trace.File = filepath.Join(config.DataDir, "trace.jsonl")
+		}
+	}
+
+	if trace.IDsFile == "" {
+		trace.IDsFile = filepath.Join(config.DataDir, "trace-ids.jsonl")
+	}
+
+	score := &config.PubSub.Score
+
+	if score.BlockTopicWeight == 0 {
+		score.BlockTopicWeight = 0.5
+	}
+
+	if score.TxTopicWeight == 0 {
+		score.TxTopicWeight = 0.5
+	}
+
+	if score.InvalidMessageWeight == 0 {
+		score.InvalidMessageWeight = -100
+	}
+
+	if score.IPColocationWeight == 0 {
+		score.IPColocationWeight = -10
+	}
+
+	if score.IPColocationThreshold == 0 {
+		score.IPColocationThreshold = 10
+	}
+
+	if config.Mempool.PriceBump == 0 {
+		config.Mempool.PriceBump = 10
+	}
+
+	if config.Mempool.MaxTxs == 0 {
+		config.Mempool.MaxTxs = 4096
+	}
+
+	if config.Mempool.MaxPerAccount == 0 {
+		config.Mempool.MaxPerAccount = 64
+	}
+
+	if config.Mempool.Lifetime == 0 {
+		config.Mempool.Lifetime = 3 * time.Hour
+	}
+
+	if config.Mempool.Journal == "" {
+		config.Mempool.Journal = filepath.Join(config.DataDir, "mempool.jsonl")
+	}
+
+	fee := &config.Mempool.Fee
+
+	if fee.History == 0 {
+		fee.History = 20
+	}
+
+	if fee.Target == 0 {
+		fee.Target = 2
+	}
+
+	if fee.Confidence == 0 {
+		fee.Confidence = 80
+	}
+
+	if config.Ban.Threshold == 0 {
+		config.Ban.Threshold = 5
+	}
+
+	if config.Ban.Duration == 0 {
+		config.Ban.Duration = 10 * time.Minute
+	}
+}
+
 // setKeyPair checks for existing key files and generates a new key pair if they do not exist
-func setKeyPair(file string) (*crypto.PrivKey, error) {
+func setKeyPair(dataDir, file string) (*crypto.PrivKey, error) {
 	log := logger.AppLogger
 
-	priv := fmt.Sprintf("/app/data/%s.pem", file)
-	pub := fmt.Sprintf("/app/data/%s.pub", file)
+	priv := filepath.Join(dataDir, fmt.Sprintf("%s.pem", file))
+	pub := filepath.Join(dataDir, fmt.Sprintf("%s.pub", file))
 
 	_, privErr := os.Stat(priv)
 	_, pubErr := os.Stat(pub)
@@ -3,6 +3,7 @@ package block
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"math/big"
 
@@ -11,6 +12,9 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 )
 
+// MaxTxs is the number of mempool transactions a miner includes in a block, besides the coinbase transaction
+const MaxTxs = 20
+
 // Block represents a block in the blockchain
 type Block struct {
 	Index        uint64 // Block height
@@ -36,6 +40,63 @@ func (block *Block) Equal(target *Block) bool {
 		block.MerkleRoot.Equal(target.MerkleRoot)
 }
 
+// HeaderHash computes the hash of the block header used as the first merkle leaf
+func (block *Block) HeaderHash() []byte {
+	header := fmt.Sprintf("%d%x%d%s%d", block.Index, block.PreviousHash, block.Timestamp, block.Miner, block.Nonce)
+	headerHash := sha256.Sum256([]byte(header))
+
+	return headerHash[:]
+}
+
+// VerifyHeader checks the merkle root, hash and proof of work of the block without chain context
+func (block *Block) VerifyHeader() error {
+	if len(block.Transactions) == 0 {
+		return fmt.Errorf("block has no transactions")
+	}
+
+	if block.MerkleRoot == nil || block.MerkleRoot.Root == nil {
+		return fmt.Errorf("block has no merkle root")
+	}
+
+	// The genesis block carries no difficulty and is checked against the local genesis instead
+	if block.Index == 0 {
+		return nil
+	}
+
+	if block.Difficulty == nil || block.Difficulty.Sign() <= 0 {
+		return fmt.Errorf("invalid difficulty")
+	}
+
+	root := ComputeMerkleRoot(block.HeaderHash(), block.Transactions)
+
+	if !bytes.Equal(root.Root.Hash, block.MerkleRoot.Root.Hash) {
+		return fmt.Errorf("merkle root mismatch")
+	}
+
+	digest := sha256.Sum256(root.Root.Hash)
+
+	if !bytes.Equal(digest[:], block.Hash) {
+		return fmt.Errorf("block hash mismatch")
+	}
+
+	if new(big.Int).SetBytes(block.Hash).Cmp(block.Difficulty) >= 0 {
+		return fmt.Errorf("block does not meet difficulty")
+	}
+
+	return nil
+}
+
+// Work returns the expected number of hashes needed to mine the block
+func (block *Block) Work() *big.Int {
+	if block.Difficulty == nil || block.Difficulty.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, block.Difficulty)
+}
+
 // Publish serializes the block into a BlockMessage and publishes it to the pubsub topic
 func (block *Block) Publish(ctx context.Context, blkTopic *pubsub.Topic) error {
 	log := logger.LabChainLogger
@@ -1,22 +1,29 @@
 package block
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
 
 // BlockMsgType defines the type of block message
 type BlockMsgType string
 
 // Constants for BlockMsgType
 const (
-	BlockMsgTypeBlock BlockMsgType = "BLOCK"
-	BlockMsgTypeReq   BlockMsgType = "REQ"
-	BlockMsgTypeResp  BlockMsgType = "RESP"
+	BlockMsgTypeBlock   BlockMsgType = "BLOCK"
+	BlockMsgTypeReq     BlockMsgType = "REQ"
+	BlockMsgTypeResp    BlockMsgType = "RESP"
+	BlockMsgTypeCompact BlockMsgType = "CMPCT"
 )
 
 // BlockMessage represents a message containing a block or a request for a block
 type BlockMessage struct {
-	Type   BlockMsgType // "BLOCK", "REQ", "RESP"
-	Blocks []*Block     // Type == "BLOCK" or "RESP"
-	Idx    uint64       // Type == "REQ"
+	Type    BlockMsgType  // "BLOCK", "REQ", "RESP", "CMPCT"
+	Blocks  []*Block      // Type == "BLOCK" or "RESP"
+	Idx     uint64        // Type == "REQ"
+	Target  peer.ID       `json:",omitempty"` // Type == "REQ", the peer asked to respond, any peer if empty
+	Compact *CompactBlock `json:",omitempty"` // Type == "CMPCT"
 }
 
 // Serialize serializes a BlockMessage to bytes
@@ -0,0 +1,172 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// PrefilledTx is a transaction sent in full inside a compact block
+type PrefilledTx struct {
+	Index int             // Position of the transaction in the block
+	Tx    *tx.Transaction // Full transaction
+}
+
+// CompactBlock is a block header carrying short transaction IDs instead of full transactions
+type CompactBlock struct {
+	Index        uint64
+	PreviousHash []byte
+	Timestamp    int64
+	Miner        string
+	Nonce        uint64
+	Hash         []byte
+	Difficulty   *big.Int
+	MerkleRoot   []byte        // Hash of the merkle root, the tree is rebuilt by the receiver
+	ShortIDs     [][]byte      // Short IDs of all transactions in block order, nil for prefilled positions
+	Prefilled    []PrefilledTx // Transactions that never appear in a mempool, e.g., the coinbase
+}
+
+// NewCompactBlock builds the compact form of the block, prefilling coinbase transactions
+func NewCompactBlock(block *Block) *CompactBlock {
+	cb := &CompactBlock{
+		Index:        block.Index,
+		PreviousHash: block.PreviousHash,
+		Timestamp:    block.Timestamp,
+		Miner:        block.Miner,
+		Nonce:        block.Nonce,
+		Hash:         block.Hash,
+		Difficulty:   block.Difficulty,
+		ShortIDs:     make([][]byte, len(block.Transactions)),
+	}
+
+	if block.MerkleRoot != nil && block.MerkleRoot.Root != nil {
+		cb.MerkleRoot = block.MerkleRoot.Root.Hash
+	}
+
+	for i, t := range block.Transactions {
+		if t.From == tx.COINBASE {
+			cb.Prefilled = append(cb.Prefilled, PrefilledTx{Index: i, Tx: t})
+		} else {
+			cb.ShortIDs[i] = t.ShortID()
+		}
+	}
+
+	return cb
+}
+
+// VerifyHeader checks the hash and proof of work of the compact block
+func (cb *CompactBlock) VerifyHeader() error {
+	if len(cb.ShortIDs) == 0 {
+		return fmt.Errorf("compact block has no transactions")
+	}
+
+	for _, p := range cb.Prefilled {
+		if p.Index < 0 || p.Index >= len(cb.ShortIDs) || p.Tx == nil {
+			return fmt.Errorf("invalid prefilled transaction at index %d", p.Index)
+		}
+	}
+
+	if cb.Difficulty == nil || cb.Difficulty.Sign() <= 0 {
+		return fmt.Errorf("invalid difficulty")
+	}
+
+	digest := sha256.Sum256(cb.MerkleRoot)
+
+	if !bytes.Equal(digest[:], cb.Hash) {
+		return fmt.Errorf("block hash mismatch")
+	}
+
+	if new(big.Int).SetBytes(cb.Hash).Cmp(cb.Difficulty) >= 0 {
+		return fmt.Errorf("block does not meet difficulty")
+	}
+
+	return nil
+}
+
+// Fill resolves the transactions of the compact block using the lookup function,
+// returning the transactions in block order and the short IDs that could not be resolved
+func (cb *CompactBlock) Fill(lookup func(shortID []byte) *tx.Transaction) ([]*tx.Transaction, [][]byte) {
+	txs := make([]*tx.Transaction, len(cb.ShortIDs))
+	missing := make([][]byte, 0)
+
+	for _, p := range cb.Prefilled {
+		txs[p.Index] = p.Tx
+	}
+
+	for i, id := range cb.ShortIDs {
+		if txs[i] != nil {
+			continue
+		}
+
+		if t := lookup(id); t != nil {
+			txs[i] = t
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return txs, missing
+}
+
+// ToBlock rebuilds the full block from its resolved transactions and checks the merkle root
+func (cb *CompactBlock) ToBlock(txs []*tx.Transaction) (*Block, error) {
+	if len(txs) != len(cb.ShortIDs) {
+		return nil, fmt.Errorf("transaction count mismatch: got %d, expected %d", len(txs), len(cb.ShortIDs))
+	}
+
+	for i, t := range txs {
+		if t == nil {
+			return nil, fmt.Errorf("transaction %d is missing", i)
+		}
+	}
+
+	block := &Block{
+		Index:        cb.Index,
+		PreviousHash: cb.PreviousHash,
+		Timestamp:    cb.Timestamp,
+		Transactions: txs,
+		Miner:        cb.Miner,
+		Nonce:        cb.Nonce,
+		Hash:         cb.Hash,
+		Difficulty:   cb.Difficulty,
+	}
+
+	block.MerkleRoot = ComputeMerkleRoot(block.HeaderHash(), txs)
+
+	if !bytes.Equal(block.MerkleRoot.Root.Hash, cb.MerkleRoot) {
+		return nil, fmt.Errorf("merkle root mismatch")
+	}
+
+	return block, nil
+}
+
+// PublishCompact publishes the block as a compact block message to the pubsub topic
+func (block *Block) PublishCompact(ctx context.Context, blkTopic *pubsub.Topic) error {
+	log := logger.LabChainLogger
+
+	msg := &BlockMessage{
+		Type:    BlockMsgTypeCompact,
+		Compact: NewCompactBlock(block),
+	}
+
+	msgBytes, err := Serialize(msg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize compact block message: %v", err)
+	}
+
+	err = blkTopic.Publish(ctx, msgBytes)
+	if err != nil {
+		return fmt.Errorf("failed to publish compact block message: %v", err)
+	}
+
+	log.Infof("compact block published successfully: index: %d, miner: %s, txs: %d, size: %d bytes, hash: %x",
+		block.Index, block.Miner, len(block.Transactions), len(msgBytes), block.Hash)
+
+	return nil
+}
@@ -62,14 +62,15 @@ func (c *Chain) CreateTx(fromPriv *ecdsa.PrivateKey, to string, amount, price *b
 	return t, nil
 }
 
-// MineBlock mines a new block with the given parameters
+// MineBlock mines a new block with the given parameters. It takes the chain lock only to read the difficulty,
+// so the caller checks that the tip is still the parent before adding the block
 func (c *Chain) MineBlock(prevHash []byte, index uint64, txs []*tx.Transaction, miner string) *block.Block {
-	var nonce uint64
-	var hash []byte
-	var root *block.MerkleTree
-
 	timestamp := time.Now().Unix()
+
+	c.Mu.Lock()
 	difficulty := c.calcDifficulty(30, 10)
+	c.Mu.Unlock()
+
 	reward := big.NewInt(100)
 
 	coinbaseTx := &tx.Transaction{
@@ -87,32 +88,32 @@ func (c *Chain) MineBlock(prevHash []byte, index uint64, txs []*tx.Transaction,
 		return txs[i].Nonce < txs[j].Nonce
 	})
 
+	b := &block.Block{
+		Index:        index,
+		PreviousHash: prevHash,
+		Timestamp:    timestamp,
+		Transactions: txs,
+		Miner:        miner,
+		Nonce:        0,
+		Hash:         nil,
+		Difficulty:   difficulty,
+		MerkleRoot:   nil,
+	}
+
 	for {
-		header := fmt.Sprintf("%d%x%d%s%d", index, prevHash, timestamp, miner, nonce)
-		headerHash := sha256.Sum256([]byte(header))
-		root = block.ComputeMerkleRoot(headerHash[:], txs)
+		b.MerkleRoot = block.ComputeMerkleRoot(b.HeaderHash(), txs)
 
-		digest := sha256.Sum256(root.Root.Hash)
-		hash = digest[:]
+		digest := sha256.Sum256(b.MerkleRoot.Root.Hash)
+		b.Hash = digest[:]
 
-		if new(big.Int).SetBytes(hash).Cmp(difficulty) < 0 {
+		if new(big.Int).SetBytes(b.Hash).Cmp(difficulty) < 0 {
 			break
 		}
 
-		nonce++
+		b.Nonce++
 	}
 
-	return &block.Block{
-		Index:        index,
-		PreviousHash: prevHash,
-		Timestamp:    timestamp,
-		Transactions: txs,
-		Miner:        miner,
-		Nonce:        nonce,
-		Hash:         hash,
-		Difficulty:   difficulty,
-		MerkleRoot:   root,
-	}
+	return b
 }
 
 // AddBlock appends a verified block to the chain
@@ -121,6 +122,54 @@ func (c *Chain) AddBlock(block *block.Block) error {
 	return nil
 }
 
+// TipChange lists the transactions that left and entered the chain when its tip changed
+type TipChange struct {
+	Disconnected []*tx.Transaction // Transactions only in the blocks that were replaced
+	Connected    []*tx.Transaction // Transactions in the blocks that were added
+}
+
+// ReplaceBlocks replaces the blocks after the last common block with those of the other chain
+// and reports the transactions that were disconnected and connected. Coinbase transactions are left out
+func (c *Chain) ReplaceBlocks(blocks []*block.Block) *TipChange {
+	fork := 0
+
+	for fork < len(c.Blocks) && fork < len(blocks) && bytes.Equal(c.Blocks[fork].Hash, blocks[fork].Hash) {
+		fork++
+	}
+
+	change := &TipChange{
+		Disconnected: nil,
+		Connected:    nil,
+	}
+
+	connected := make(map[string]bool)
+
+	for _, blk := range blocks[fork:] {
+		for _, t := range blk.Transactions {
+			if t.From == tx.COINBASE {
+				continue
+			}
+
+			connected[string(t.Hash())] = true
+			change.Connected = append(change.Connected, t)
+		}
+	}
+
+	for _, blk := range c.Blocks[fork:] {
+		for _, t := range blk.Transactions {
+			if t.From == tx.COINBASE || connected[string(t.Hash())] {
+				continue
+			}
+
+			change.Disconnected = append(change.Disconnected, t)
+		}
+	}
+
+	c.Blocks = blocks
+
+	return change
+}
+
 // VerifyNewBlock checks if a block is valid against the previous block
 func (c *Chain) VerifyNewBlock(b *block.Block, previous *block.Block) bool {
 	log := logger.LabChainLogger
@@ -187,10 +236,7 @@ func (c *Chain) VerifyNewBlock(b *block.Block, previous *block.Block) bool {
 		}
 	}
 
-	header := fmt.Sprintf("%d%x%d%s%d", b.Index, b.PreviousHash, b.Timestamp, b.Miner, b.Nonce)
-	headerHash := sha256.Sum256([]byte(header))
-
-	root := block.ComputeMerkleRoot(headerHash[:], b.Transactions)
+	root := block.ComputeMerkleRoot(b.HeaderHash(), b.Transactions)
 
 	if b.MerkleRoot == nil || !bytes.Equal(b.MerkleRoot.Root.Hash, root.Root.Hash) {
 		log.Infof("merkle root mismatch: expected=%s, actual=%s", b.MerkleRoot.Root.Hash, root.Root.Hash)
@@ -285,6 +331,25 @@ func (c *Chain) GetNonce(address string, base int) uint64 {
 	return nonce + uint64(base)
 }
 
+// GetNonces calculates the nonces of the given addresses in a single pass over the chain
+func (c *Chain) GetNonces(addresses []string) map[string]uint64 {
+	nonces := make(map[string]uint64, len(addresses))
+
+	for _, addr := range addresses {
+		nonces[addr] = 0
+	}
+
+	for _, blk := range c.Blocks {
+		for _, tx := range blk.Transactions {
+			if n, ok := nonces[tx.From]; ok {
+				nonces[tx.From] = n + 1
+			}
+		}
+	}
+
+	return nonces
+}
+
 // GetBlockByIndex returns the block at the specified index
 func (c *Chain) GetBlockByIndex(i uint64) *block.Block {
 	c.Mu.Lock()
@@ -297,6 +362,20 @@ func (c *Chain) GetBlockByIndex(i uint64) *block.Block {
 	return nil
 }
 
+// RecentBlocks returns up to n of the latest blocks, oldest first
+func (c *Chain) RecentBlocks(n int) []*block.Block {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	start := len(c.Blocks) - n
+
+	if start < 0 {
+		start = 0
+	}
+
+	return append([]*block.Block{}, c.Blocks[start:]...)
+}
+
 // GetBlockByHash searches the chain for a block with the given hash
 func (c *Chain) GetBlockByHash(hash []byte) *block.Block {
 	for _, blk := range c.Blocks {
@@ -308,6 +387,17 @@ func (c *Chain) GetBlockByHash(hash []byte) *block.Block {
 	return nil
 }
 
+// TotalWork returns the accumulated proof of work of all blocks in the chain
+func (c *Chain) TotalWork() *big.Int {
+	total := new(big.Int)
+
+	for _, blk := range c.Blocks {
+		total.Add(total, blk.Work())
+	}
+
+	return total
+}
+
 // GetBalance calculates the balance of a given address
 func (c *Chain) GetBalance(address string) *big.Int {
 	balance := new(big.Int)
@@ -349,23 +439,23 @@ func createGenesisBlock(to string) *block.Block {
 		},
 	}
 
-	header := fmt.Sprintf("0%x%d%s%d", []byte{}, time.Now().Unix(), to, 0)
-	headerHash := sha256.Sum256([]byte(header))
-	root := block.ComputeMerkleRoot(headerHash[:], txs)
-
-	digest := sha256.Sum256(root.Root.Hash)
-	hash := digest[:]
-
-	return &block.Block{
+	b := &block.Block{
 		Index:        0,
 		PreviousHash: []byte{},
 		Timestamp:    time.Now().Unix(),
 		Transactions: txs,
 		Miner:        to,
 		Nonce:        0,
-		Hash:         hash,
-		MerkleRoot:   root,
+		Hash:         nil,
+		MerkleRoot:   nil,
 	}
+
+	b.MerkleRoot = block.ComputeMerkleRoot(b.HeaderHash(), txs)
+
+	digest := sha256.Sum256(b.MerkleRoot.Root.Hash)
+	b.Hash = digest[:]
+
+	return b
 }
 
 // calcDifficulty calculates the new difficulty based on recent blocks
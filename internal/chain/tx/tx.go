@@ -15,6 +15,9 @@ import (
 
 const COINBASE = "COINBASE"
 
+// ShortIDSize is the length of the short transaction IDs used in compact blocks
+const ShortIDSize = 8
+
 // Transaction represents a transaction in the lab-chain network
 type Transaction struct {
 	From      string   `json:"from"`      // Sender's address
@@ -87,6 +90,11 @@ func (tx *Transaction) Hash() []byte {
 	return hash
 }
 
+// ShortID returns the truncated transaction hash used to reference the transaction in compact blocks
+func (tx *Transaction) ShortID() []byte {
+	return tx.Hash()[:ShortIDSize]
+}
+
 // NewTransaction creates a new transaction with the given parameters
 func (tx *Transaction) Sign(privKey *ecdsa.PrivateKey) error {
 	hash := tx.Hash()
@@ -49,7 +49,7 @@ func chainFunc(user *user.User, args []string) {
 			fmt.Printf("Blockchain loaded successfully from %s.\n", file)
 		}
 
-		user.Chain = c
+		user.SetChain(c)
 
 		subscribeToTopics(user)
 	case "request":
@@ -73,4 +73,6 @@ func subscribeToTopics(user *user.User) {
 	handler.RunSubscribeAndCollectTx(user)
 
 	handler.RunSubscribeAndCollectBlock(user)
+
+	handler.RestoreLocalTxs(user)
 }
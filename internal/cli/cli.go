@@ -8,6 +8,9 @@ import (
 	"github.com/elecbug/lab-chain/internal/user"
 )
 
+// console is the readline instance of the running CLI, used to prompt for passphrases
+var console *readline.Instance
+
 // CliCommand defines the command-line interface for blockchain operations
 func CliCommand(user *user.User) {
 	rl, err := readline.NewEx(&readline.Config{
@@ -23,6 +26,8 @@ func CliCommand(user *user.User) {
 	}
 	defer rl.Close()
 
+	console = rl
+
 	fmt.Println("Cli started. Type 'help' to see available commands.")
 
 	for {
@@ -42,7 +47,7 @@ func CliCommand(user *user.User) {
 
 		switch args[0] {
 		case "help":
-			fmt.Println("Available commands: help, exit, master-key, wallet, tx, mine, chain")
+			fmt.Println("Available commands: help, exit, master-key, wallet, tx, mempool, mine, chain, peers")
 		case "exit":
 			return
 		case "master-key":
@@ -51,10 +56,14 @@ func CliCommand(user *user.User) {
 			walletFunc(user, args)
 		case "tx":
 			txFunc(user, args)
+		case "mempool":
+			mempoolFunc(user, args)
 		case "mine":
 			mineFunc(user, args)
 		case "chain":
 			chainFunc(user, args)
+		case "peers":
+			peersFunc(user, args)
 		default:
 			fmt.Printf("Unknown command. Type 'help' for options.\n")
 		}
@@ -66,11 +75,13 @@ type cliCompleter struct{}
 // Completer implements the readline completer interface for command-line autocompletion
 func (c *cliCompleter) Do(line []rune, pos int) ([][]rune, int) {
 	cmdMap := map[string][]string{
-		"master-key": {"gen", "save", "load"},
-		"wallet":     {"set", "balance"},
-		"tx":         {},
+		"master-key": {"gen", "restore", "save", "load"},
+		"wallet":     {"set", "use", "list", "balance"},
+		"tx":         {"bump", "estimate"},
+		"mempool":    {"list", "show", "stats", "clear"},
 		"mine":       {"genesis"},
 		"chain":      {"save", "load", "request"},
+		"peers":      {"list", "known", "add", "remove", "bans", "unban"},
 		"help":       {},
 		"exit":       {},
 	}
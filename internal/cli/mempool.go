@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/user"
+	"github.com/elecbug/lab-chain/internal/user/mempool"
+)
+
+func mempoolFunc(user *user.User, args []string) {
+	if len(args) < 2 {
+		fmt.Printf("Usage: mempool <list [price|sender|nonce]|show <hash>|stats|clear [--include-local]>\n")
+		return
+	}
+
+	command := args[1]
+
+	switch command {
+	case "list":
+		order := "price"
+
+		if len(args) == 3 {
+			order = args[2]
+		}
+
+		listMempool(user, order)
+	case "show":
+		if len(args) != 3 {
+			fmt.Printf("Usage: mempool show <hash>\n")
+			return
+		}
+
+		hash, err := hex.DecodeString(strings.TrimPrefix(args[2], "0x"))
+
+		if err != nil {
+			fmt.Printf("Invalid hash: %v.\n", err)
+
+			return
+		}
+
+		e, ok := user.MemPool.Lookup(hash)
+
+		if !ok {
+			fmt.Printf("Transaction not found in mempool: %x.\n", hash)
+			return
+		}
+
+		fmt.Printf("hash: %x\n  from: %s\n  to: %s\n  amount: %s  price: %s  nonce: %d\n  lane: %s  local: %t  age: %s\n  signature: %x\n",
+			e.Tx.Hash(), e.Tx.From, e.Tx.To, e.Tx.Amount.String(), e.Tx.Price.String(), e.Tx.Nonce,
+			lane(e), e.Local, time.Since(e.Added).Round(time.Second), e.Tx.Signature)
+	case "stats":
+		mempoolStats(user)
+	case "clear":
+		includeLocal := false
+
+		if len(args) == 3 && args[2] == "--include-local" {
+			includeLocal = true
+		} else if len(args) != 2 {
+			fmt.Printf("Usage: mempool clear [--include-local]\n")
+			return
+		}
+
+		n := user.MemPool.Clear(includeLocal)
+
+		if includeLocal {
+			fmt.Printf("Mempool cleared: %d transactions removed, local transactions are dropped from the journal.\n", n)
+		} else {
+			fmt.Printf("Mempool cleared: %d transactions removed, local transactions kept.\n", n)
+		}
+	default:
+		fmt.Printf("Usage: mempool <list [price|sender|nonce]|show <hash>|stats|clear [--include-local]>\n")
+	}
+}
+
+// listMempool prints the transactions in the mempool in the given order
+func listMempool(user *user.User, order string) {
+	entries := user.MemPool.Entries()
+
+	bySender := func(a, b mempool.Entry) bool {
+		if a.Tx.From != b.Tx.From {
+			return a.Tx.From < b.Tx.From
+		}
+
+		return a.Tx.Nonce < b.Tx.Nonce
+	}
+
+	switch order {
+	case "price":
+		sort.Slice(entries, func(i, j int) bool {
+			if c := entries[i].Tx.Price.Cmp(entries[j].Tx.Price); c != 0 {
+				return c > 0
+			}
+
+			return bySender(entries[i], entries[j])
+		})
+	case "sender":
+		sort.Slice(entries, func(i, j int) bool {
+			return bySender(entries[i], entries[j])
+		})
+	case "nonce":
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Tx.Nonce != entries[j].Tx.Nonce {
+				return entries[i].Tx.Nonce < entries[j].Tx.Nonce
+			}
+
+			return entries[i].Tx.From < entries[j].Tx.From
+		})
+	default:
+		fmt.Printf("Unknown order: %s. Use price, sender or nonce.\n", order)
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("Mempool is empty.\n")
+		return
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%x  from: %s  nonce: %d  price: %s  amount: %s  %s  age: %s\n",
+			e.Tx.Hash(), e.Tx.From, e.Tx.Nonce, e.Tx.Price.String(), e.Tx.Amount.String(),
+			lane(e), time.Since(e.Added).Round(time.Second))
+	}
+}
+
+// mempoolStats prints the size of the mempool, a histogram of prices and the number of transactions per sender
+func mempoolStats(user *user.User) {
+	entries := user.MemPool.Entries()
+
+	pending, local, size := 0, 0, 0
+	senders := make(map[string]int)
+	buckets := make(map[int]int) // Bucket i holds prices in [2^(i-1), 2^i), bucket 0 holds price 0
+
+	for _, e := range entries {
+		if e.Pending {
+			pending++
+		}
+
+		if e.Local {
+			local++
+		}
+
+		if data, err := tx.Serialize(e.Tx); err == nil {
+			size += len(data)
+		}
+
+		senders[e.Tx.From]++
+		buckets[e.Tx.Price.BitLen()]++
+	}
+
+	fmt.Printf("transactions: %d  pending: %d  queued: %d  local: %d  bytes: %d\n",
+		len(entries), pending, len(entries)-pending, local, size)
+
+	if len(entries) == 0 {
+		return
+	}
+
+	bits := make([]int, 0, len(buckets))
+
+	for b := range buckets {
+		bits = append(bits, b)
+	}
+
+	sort.Ints(bits)
+
+	fmt.Printf("price histogram:\n")
+
+	for _, b := range bits {
+		low, high := new(big.Int), new(big.Int)
+
+		if b > 0 {
+			low.Lsh(big.NewInt(1), uint(b-1))
+			high.Lsh(big.NewInt(1), uint(b))
+			high.Sub(high, big.NewInt(1))
+		}
+
+		fmt.Printf("  %s-%s: %d\n", low.String(), high.String(), buckets[b])
+	}
+
+	addrs := make([]string, 0, len(senders))
+
+	for addr := range senders {
+		addrs = append(addrs, addr)
+	}
+
+	sort.Slice(addrs, func(i, j int) bool {
+		if senders[addrs[i]] != senders[addrs[j]] {
+			return senders[addrs[i]] > senders[addrs[j]]
+		}
+
+		return addrs[i] < addrs[j]
+	})
+
+	fmt.Printf("senders:\n")
+
+	for _, addr := range addrs {
+		fmt.Printf("  %s: %d\n", addr, senders[addr])
+	}
+}
+
+// lane returns the name of the lane the transaction is in
+func lane(e mempool.Entry) string {
+	if e.Pending {
+		return "pending"
+	}
+
+	return "queued"
+}
@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/elecbug/lab-chain/internal/chain"
+	"github.com/elecbug/lab-chain/internal/chain/block"
 	"github.com/elecbug/lab-chain/internal/user"
 )
 
@@ -23,14 +25,42 @@ func mineFunc(user *user.User, args []string) {
 			return
 		}
 
+		user.Chain.Mu.Lock()
 		last := user.Chain.Blocks[len(user.Chain.Blocks)-1]
+		user.Chain.Mu.Unlock()
 
-		txs := user.MemPool.PickTopTxs(20)
+		txs := user.MemPool.SelectTxs(block.MaxTxs)
 
 		b := user.Chain.MineBlock(last.Hash, last.Index+1, txs, user.CurrentAddress.Hex())
-		user.Chain.Blocks = append(user.Chain.Blocks, b)
 
-		err := b.Publish(user.Context, user.BlockTopic)
+		user.Chain.Mu.Lock()
+		tip := user.Chain.Blocks[len(user.Chain.Blocks)-1]
+
+		// A block received while mining moves the tip, and the mined block would then have the wrong parent
+		if !bytes.Equal(tip.Hash, last.Hash) {
+			user.Chain.Mu.Unlock()
+
+			fmt.Printf("Chain tip changed while mining, block discarded: index %d, new tip index %d. Please mine again.\n", b.Index, tip.Index)
+			return
+		}
+
+		err := user.Chain.AddBlock(b)
+		user.Chain.Mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("Failed to add block: %v.\n", err)
+
+			return
+		}
+
+		// If the block loses a fork later, its transactions return to the mempool with the chain update
+		user.MemPool.ApplyTipChange(nil, txs)
+
+		if user.Config.Relay.CompactBlocks {
+			err = b.PublishCompact(user.Context, user.BlockTopic)
+		} else {
+			err = b.Publish(user.Context, user.BlockTopic)
+		}
 
 		if err != nil {
 			fmt.Printf("Failed to publish block: %v.\n", err)
@@ -57,7 +87,7 @@ func genesisFunc(user *user.User) {
 		return
 	}
 
-	user.Chain = chain.InitChain(user.CurrentAddress.Hex())
+	user.SetChain(chain.InitChain(user.CurrentAddress.Hex()))
 
 	fmt.Printf("Genesis block created successfully: index %d, miner %s, nonce %d, hash %x.\n",
 		user.Chain.Blocks[0].Index,
@@ -2,23 +2,40 @@ package cli
 
 import (
 	"fmt"
+	"strconv"
 
+	"github.com/chzyer/readline"
 	"github.com/elecbug/lab-chain/internal/user"
 	"github.com/elecbug/lab-chain/internal/user/wallet"
 )
 
 func masterKeyFunc(user *user.User, args []string) {
-	if len(args) != 3 {
-		fmt.Printf("Usage: master-key <command> <file>\n")
+	if len(args) < 3 {
+		fmt.Printf("Usage: master-key <command> <file> [--words <12|15|18|21|24>] [--passphrase]\n")
 		return
 	}
 
 	command := args[1]
 	file := args[2]
 
+	words, withPassphrase, err := parseMasterKeyOptions(args[3:])
+
+	if err != nil {
+		fmt.Printf("%v.\n", err)
+		return
+	}
+
 	switch command {
 	case "gen":
-		masterKey, err := wallet.GenerateMasterKey()
+		seedPassphrase, err := readSeedPassphrase(withPassphrase, true)
+
+		if err != nil {
+			fmt.Printf("Failed to read passphrase: %v.\n", err)
+
+			return
+		}
+
+		masterKey, mnemonic, err := wallet.GenerateMasterKey(words, seedPassphrase)
 		if err != nil {
 			fmt.Printf("Failed to generate master key: %v.\n", err)
 
@@ -28,33 +45,74 @@ func masterKeyFunc(user *user.User, args []string) {
 		}
 
 		user.MasterKey = masterKey
+		user.Wallet = wallet.NewWallet(masterKey)
+
+		fmt.Printf("Mnemonic (write it down, it will not be shown again):\n\n  %s\n\n", mnemonic)
+
+		if withPassphrase {
+			fmt.Printf("The BIP-39 passphrase is needed together with the mnemonic to restore the master key.\n")
+		}
+
+		saveMasterKey(user, file)
+	case "restore":
+		if user.MasterKey != nil {
+			fmt.Printf("Master key already loaded. Please reset first.\n")
+			return
+		}
+
+		// Read without echo, so the mnemonic stays out of the terminal and the history file
+		mnemonic, err := readPassphrase("Mnemonic: ", false)
+
+		if err != nil {
+			fmt.Printf("Failed to read mnemonic: %v.\n", err)
+
+			return
+		}
+
+		seedPassphrase, err := readSeedPassphrase(withPassphrase, false)
+
+		if err != nil {
+			fmt.Printf("Failed to read passphrase: %v.\n", err)
+
+			return
+		}
 
-		if err := wallet.SaveMasterKey(file, user.MasterKey); err != nil {
-			fmt.Printf("Failed to save master key: %v.\n", err)
+		masterKey, err := wallet.RestoreMasterKey(mnemonic, seedPassphrase)
 
+		if err != nil {
+			fmt.Printf("Failed to restore master key: %v.\n", err)
+
+			return
 		} else {
-			fmt.Printf("Master key saved to file successfully: %s.\n", file)
+			fmt.Printf("Master key restored successfully.\n")
 		}
 
+		user.MasterKey = masterKey
+		user.Wallet = wallet.NewWallet(masterKey)
+
+		saveMasterKey(user, file)
 	case "save":
 		if user.MasterKey == nil {
 			fmt.Printf("No master key generated. Please generate it first.\n")
 			return
 		}
 
-		if err := wallet.SaveMasterKey(file, user.MasterKey); err != nil {
-			fmt.Printf("Failed to save master key: %v.\n", err)
-
-		} else {
-			fmt.Printf("Master key saved to file successfully: %s.\n", file)
-		}
+		saveMasterKey(user, file)
 	case "load":
 		if user.MasterKey != nil {
 			fmt.Printf("Master key already loaded. Please reset first.\n")
 			return
 		}
 
-		masterKey, err := wallet.LoadMasterKey(file)
+		passphrase, err := readPassphrase("Passphrase: ", false)
+
+		if err != nil {
+			fmt.Printf("Failed to read passphrase: %v.\n", err)
+
+			return
+		}
+
+		masterKey, err := wallet.LoadMasterKey(file, passphrase)
 
 		if err != nil {
 			fmt.Printf("Failed to load master key: %v.\n", err)
@@ -65,8 +123,101 @@ func masterKeyFunc(user *user.User, args []string) {
 		}
 
 		user.MasterKey = masterKey
+		user.Wallet = wallet.NewWallet(masterKey)
 	default:
-		fmt.Printf("Usage: master-key <command> <file>\n")
+		fmt.Printf("Usage: master-key <command> <file> [--words <12|15|18|21|24>] [--passphrase]\n")
+		return
+	}
+}
+
+// parseMasterKeyOptions parses the mnemonic word count and whether a BIP-39 passphrase is used
+func parseMasterKeyOptions(args []string) (int, bool, error) {
+	words := 12
+	withPassphrase := false
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--words":
+			if i+1 >= len(args) {
+				return 0, false, fmt.Errorf("missing number of words")
+			}
+
+			n, err := strconv.Atoi(args[i+1])
+
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid number of words: %s", args[i+1])
+			}
+
+			words = n
+			i++
+		case "--passphrase":
+			withPassphrase = true
+		default:
+			return 0, false, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	return words, withPassphrase, nil
+}
+
+// readSeedPassphrase prompts for the BIP-39 passphrase if one is used, confirming a new one
+func readSeedPassphrase(withPassphrase bool, confirm bool) (string, error) {
+	if !withPassphrase {
+		return "", nil
+	}
+
+	return readPassphrase("BIP-39 passphrase: ", confirm)
+}
+
+// saveMasterKey prompts for a new passphrase and saves the master key of the user encrypted with it
+func saveMasterKey(user *user.User, file string) {
+	passphrase, err := readPassphrase("New passphrase: ", true)
+
+	if err != nil {
+		fmt.Printf("Failed to read passphrase: %v.\n", err)
+
 		return
 	}
+
+	if err := wallet.SaveMasterKey(file, user.MasterKey, passphrase); err != nil {
+		fmt.Printf("Failed to save master key: %v.\n", err)
+
+	} else {
+		fmt.Printf("Master key saved to file successfully: %s.\n", file)
+	}
+}
+
+// readPassphrase prompts for a passphrase without echoing it, asking a second time to confirm a new one
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	read := readline.Password
+
+	if console != nil {
+		read = console.ReadPassword
+	}
+
+	passphrase, err := read(prompt)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !confirm {
+		return string(passphrase), nil
+	}
+
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+
+	repeated, err := read("Repeat passphrase: ")
+
+	if err != nil {
+		return "", err
+	}
+
+	if string(repeated) != string(passphrase) {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+
+	return string(passphrase), nil
 }
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/user"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func peersFunc(user *user.User, args []string) {
+	if len(args) < 2 {
+		listPeers(user)
+		return
+	}
+
+	command := args[1]
+
+	switch command {
+	case "list":
+		listPeers(user)
+	case "bans":
+		bans := user.Bans.Bans()
+
+		if len(bans) == 0 {
+			fmt.Printf("No banned peers.\n")
+			return
+		}
+
+		for _, ban := range bans {
+			fmt.Printf("%s  remaining: %s  reason: %s\n",
+				ban.PeerID, time.Until(ban.Until).Round(time.Second), ban.Reason)
+		}
+	case "unban":
+		if len(args) != 3 {
+			fmt.Printf("Usage: peers unban <peer-id>\n")
+			return
+		}
+
+		p, err := peer.Decode(args[2])
+
+		if err != nil {
+			fmt.Printf("Invalid peer ID: %v.\n", err)
+
+			return
+		}
+
+		if user.Bans.Unban(p) {
+			fmt.Printf("Peer unbanned successfully: %s.\n", p)
+		} else {
+			fmt.Printf("Peer is not banned: %s.\n", p)
+		}
+	case "known":
+		records := user.AddressBook.Records()
+
+		if len(records) == 0 {
+			fmt.Printf("No known peers.\n")
+			return
+		}
+
+		for _, r := range records {
+			manual := ""
+			if r.Manual {
+				manual = " (manual)"
+			}
+
+			lastSeen := "never"
+			if !r.LastSeen.IsZero() {
+				lastSeen = time.Since(r.LastSeen).Round(time.Second).String() + " ago"
+			}
+
+			fmt.Printf("%s%s  score: %.2f  last seen: %s\n  addrs: %s\n",
+				r.ID, manual, r.Score, lastSeen, strings.Join(r.Addrs, ", "))
+		}
+	case "add":
+		if len(args) != 3 {
+			fmt.Printf("Usage: peers add <multiaddr>\n")
+			return
+		}
+
+		addr, err := multiaddr.NewMultiaddr(args[2])
+
+		if err != nil {
+			fmt.Printf("Invalid multiaddr: %v.\n", err)
+			return
+		}
+
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+
+		if err != nil {
+			fmt.Printf("Multiaddr must end with /p2p/<peer-id>: %v.\n", err)
+			return
+		}
+
+		user.AddressBook.Add(*info)
+
+		if err := user.AddressBook.Save(); err != nil {
+			fmt.Printf("Failed to save address book: %v.\n", err)
+		}
+
+		ctx, cancel := context.WithTimeout(user.Context, 10*time.Second)
+		defer cancel()
+
+		if err := user.Host.Connect(ctx, *info); err != nil {
+			fmt.Printf("Peer added, but connecting failed: %v.\n", err)
+		} else {
+			fmt.Printf("Peer added and connected successfully: %s.\n", info.ID)
+		}
+	case "remove":
+		if len(args) != 3 {
+			fmt.Printf("Usage: peers remove <peer-id>\n")
+			return
+		}
+
+		p, err := peer.Decode(args[2])
+
+		if err != nil {
+			fmt.Printf("Invalid peer ID: %v.\n", err)
+
+			return
+		}
+
+		known := user.AddressBook.Remove(p)
+
+		if err := user.AddressBook.Save(); err != nil {
+			fmt.Printf("Failed to save address book: %v.\n", err)
+		}
+
+		user.Host.Peerstore().ClearAddrs(p)
+		user.Host.Network().ClosePeer(p)
+
+		if known {
+			fmt.Printf("Peer removed and disconnected successfully: %s.\n", p)
+		} else {
+			fmt.Printf("Peer is not known, disconnected: %s.\n", p)
+		}
+	default:
+		fmt.Printf("Usage: peers <command> [args]\n")
+		return
+	}
+}
+
+func listPeers(user *user.User) {
+	h := user.Host
+	conns := h.Network().Conns()
+
+	if len(conns) == 0 {
+		fmt.Printf("No connected peers.\n")
+		return
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Stat().Opened.Before(conns[j].Stat().Opened)
+	})
+
+	for _, conn := range conns {
+		p := conn.RemotePeer()
+		stat := conn.Stat()
+
+		protocols, _ := h.Peerstore().GetProtocols(p)
+
+		names := make([]string, 0, len(protocols))
+		for _, proto := range protocols {
+			names = append(names, string(proto))
+		}
+		sort.Strings(names)
+
+		protected := ""
+		if h.ConnManager().IsProtected(p, "") {
+			protected = " (protected)"
+		}
+
+		fmt.Printf("%s%s\n  addr: %s  direction: %s  latency: %s  age: %s\n  protocols: %s\n",
+			p, protected, conn.RemoteMultiaddr(), stat.Direction,
+			h.Peerstore().LatencyEWMA(p).Round(time.Microsecond),
+			time.Since(stat.Opened).Round(time.Second),
+			strings.Join(names, ", "))
+
+		if status := user.Statuses.Get(p); status != nil {
+			fmt.Printf("  mode: %s  head: %d (%x)  total work: %s\n",
+				status.Mode, status.HeadHeight, status.HeadHash, status.TotalWork)
+		}
+	}
+
+	fmt.Printf("Total %d connections to %d peers.\n", len(conns), len(h.Network().Peers()))
+}
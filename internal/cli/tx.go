@@ -1,16 +1,30 @@
 package cli
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/handler"
 	"github.com/elecbug/lab-chain/internal/user"
 )
 
 func txFunc(user *user.User, args []string) {
-	if len(args) != 4 {
-		fmt.Printf("Usage: tx <to> <amount> <price>\n")
+	if len(args) > 1 && args[1] == "bump" {
+		bumpTx(user, args)
+		return
+	}
+
+	if len(args) > 1 && args[1] == "estimate" {
+		estimateFee(user, args)
+		return
+	}
+
+	if len(args) != 3 && len(args) != 4 {
+		fmt.Printf("Usage: tx <to> <amount> [price] | tx bump <hash> <new-price> | tx estimate [blocks] [confidence]\n")
 		return
 	}
 
@@ -23,12 +37,18 @@ func txFunc(user *user.User, args []string) {
 		return
 	}
 
-	price, err := strconv.ParseInt(args[3], 10, 64)
+	var price *big.Int
 
-	if err != nil {
-		fmt.Printf("Invalid price: %v.\n", err)
+	if len(args) == 4 {
+		p, err := strconv.ParseInt(args[3], 10, 64)
 
-		return
+		if err != nil {
+			fmt.Printf("Invalid price: %v.\n", err)
+
+			return
+		}
+
+		price = big.NewInt(p)
 	}
 
 	if user.MasterKey == nil {
@@ -44,21 +64,158 @@ func txFunc(user *user.User, args []string) {
 		return
 	}
 
-	tx, err := user.Chain.CreateTx(user.CurrentPrivKey, to, big.NewInt(amount), big.NewInt(price), user.MemPool.GetBase(user.CurrentAddress.Hex()))
+	if price == nil {
+		fee := user.Config.Mempool.Fee
+		price = estimatePrice(user, fee.Target, fee.Confidence)
+
+		fmt.Printf("Using estimated price %s for inclusion within %d blocks.\n", price.String(), fee.Target)
+	}
+
+	tx, err := user.Chain.CreateTx(user.CurrentPrivKey, to, big.NewInt(amount), price, user.MemPool.GetBase(user.CurrentAddress.Hex()))
 
 	if err != nil {
 		fmt.Printf("Failed to create transaction: %v.\n", err)
 
 		return
 	} else {
-		fmt.Printf("Transaction created successfully: %s -> %s, amount: %s, price: %s.\n",
-			tx.From, tx.To, tx.Amount.String(), tx.Price.String())
+		fmt.Printf("Transaction created successfully: %s -> %s, amount: %s, price: %s, nonce: %d, hash: %x.\n",
+			tx.From, tx.To, tx.Amount.String(), tx.Price.String(), tx.Nonce, tx.Hash())
+	}
+
+	if !user.MemPool.AddLocal(tx) {
+		fmt.Printf("Transaction rejected by the mempool.\n")
+		return
+	}
+
+	if err := handler.BroadcastTx(user, tx); err != nil {
+		fmt.Printf("Failed to publish transaction: %v.\n", err)
+
+	} else {
+		fmt.Printf("Transaction published successfully.\n")
+	}
+}
+
+// bumpTx replaces a pending transaction of the current address with a copy paying a higher price
+func bumpTx(user *user.User, args []string) {
+	if len(args) != 4 {
+		fmt.Printf("Usage: tx bump <hash> <new-price>\n")
+		return
+	}
+
+	hash, err := hex.DecodeString(strings.TrimPrefix(args[2], "0x"))
+
+	if err != nil {
+		fmt.Printf("Invalid hash: %v.\n", err)
+
+		return
+	}
+
+	price, err := strconv.ParseInt(args[3], 10, 64)
+
+	if err != nil {
+		fmt.Printf("Invalid price: %v.\n", err)
+
+		return
+	}
+
+	if user.CurrentAddress == nil {
+		fmt.Printf("No current address set. Please set it first.\n")
+		return
+	}
+
+	old := user.MemPool.GetByHash(hash)
+
+	if old == nil {
+		fmt.Printf("Transaction not found in mempool: %x.\n", hash)
+		return
+	}
+
+	if !strings.EqualFold(old.From, user.CurrentAddress.Hex()) {
+		fmt.Printf("Transaction was not sent from the current address: %s.\n", old.From)
+		return
+	}
+
+	t := &tx.Transaction{
+		From:      old.From,
+		To:        old.To,
+		Amount:    old.Amount,
+		Nonce:     old.Nonce,
+		Price:     big.NewInt(price),
+		Signature: nil,
+	}
+
+	if required := user.MemPool.ReplacementPrice(t); required != nil && t.Price.Cmp(required) < 0 {
+		fmt.Printf("Price too low: replacing price %s requires at least %s.\n", old.Price.String(), required.String())
+		return
+	}
+
+	if err := t.Sign(user.CurrentPrivKey); err != nil {
+		fmt.Printf("Failed to sign transaction: %v.\n", err)
+
+		return
+	} else {
+		fmt.Printf("Transaction bumped successfully: nonce: %d, price: %s -> %s, hash: %x.\n",
+			t.Nonce, old.Price.String(), t.Price.String(), t.Hash())
+	}
+
+	if !user.MemPool.AddLocal(t) {
+		fmt.Printf("Transaction rejected by the mempool.\n")
+		return
 	}
 
-	if err := tx.Publish(user.Context, user.TxTopic); err != nil {
+	if err := handler.BroadcastTx(user, t); err != nil {
 		fmt.Printf("Failed to publish transaction: %v.\n", err)
 
 	} else {
 		fmt.Printf("Transaction published successfully.\n")
 	}
 }
+
+// estimateFee prints the price that gets a transaction included within the given number of blocks
+func estimateFee(user *user.User, args []string) {
+	if len(args) > 4 {
+		fmt.Printf("Usage: tx estimate [blocks] [confidence]\n")
+		return
+	}
+
+	if user.Chain == nil {
+		fmt.Printf("Blockchain not initialized. Please create genesis block first.\n")
+		return
+	}
+
+	target := user.Config.Mempool.Fee.Target
+	confidence := user.Config.Mempool.Fee.Confidence
+
+	if len(args) >= 3 {
+		n, err := strconv.Atoi(args[2])
+
+		if err != nil || n < 1 {
+			fmt.Printf("Invalid number of blocks: %s.\n", args[2])
+			return
+		}
+
+		target = n
+	}
+
+	if len(args) == 4 {
+		n, err := strconv.Atoi(strings.TrimSuffix(args[3], "%"))
+
+		if err != nil || n < 1 || n > 100 {
+			fmt.Printf("Invalid confidence: %s.\n", args[3])
+			return
+		}
+
+		confidence = n
+	}
+
+	price := estimatePrice(user, target, confidence)
+
+	fmt.Printf("Estimated price: %s for inclusion within %d blocks with %d%% confidence.\n", price.String(), target, confidence)
+}
+
+// estimatePrice estimates the price from recent blocks and the mempool. The chain lock must not be held
+func estimatePrice(user *user.User, target, confidence int) *big.Int {
+	recent := user.Chain.RecentBlocks(user.Config.Mempool.Fee.History)
+
+	return user.MemPool.EstimatePrice(recent, target, confidence)
+}
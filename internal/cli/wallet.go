@@ -3,58 +3,158 @@ package cli
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/elecbug/lab-chain/internal/user"
 	"github.com/elecbug/lab-chain/internal/user/wallet"
 )
 
 func walletFunc(user *user.User, args []string) {
-	if len(args) != 2 && len(args) != 3 {
-		fmt.Printf("Usage: wallet <command> [args]\n")
+	if len(args) < 2 || len(args) > 4 {
+		fmt.Printf("Usage: wallet <set <idx|path> [label]|use <label|idx>|list|balance>\n")
 		return
 	}
 
 	command := args[1]
 
+	if user.MasterKey == nil || user.Wallet == nil {
+		fmt.Printf("No master key loaded. Please load it first.\n")
+		return
+	}
+
 	switch command {
 	case "set":
-		if user.MasterKey == nil {
-			fmt.Printf("No master key loaded. Please load it first.\n")
+		if len(args) < 3 {
+			fmt.Printf("Usage: wallet set <idx|path> [label]\n")
 			return
 		}
 
-		idxString := args[2]
-		idx, err := strconv.Atoi(idxString)
+		path, err := parseWalletPath(args[2])
 
 		if err != nil {
-			fmt.Printf("Invalid index: %v.\n", err)
+			fmt.Printf("Invalid index or path: %v.\n", err)
 
 			return
 		}
 
-		priv, addr, err := wallet.GenerateAddress(user.MasterKey, idx)
+		label := ""
+
+		if len(args) == 4 {
+			label = args[3]
+		}
+
+		account, err := user.Wallet.Derive(path, label)
 
 		if err != nil {
 			fmt.Printf("Failed to generate address: %v.\n", err)
 
 			return
 		} else {
-			user.CurrentPrivKey = priv
-			user.CurrentAddress = addr
+			useAccount(user, account)
+
+			fmt.Printf("Address generated successfully: path %s, address %s.\n", account.Path, account.Address.Hex())
+		}
+	case "use":
+		if len(args) != 3 {
+			fmt.Printf("Usage: wallet use <label|idx>\n")
+			return
+		}
+
+		account, err := user.Wallet.Find(args[2])
+
+		if err != nil {
+			fmt.Printf("Account not found: %v.\n", err)
 
-			fmt.Printf("Address generated successfully: index %d, address %s.\n", idx, addr.Hex())
+			return
 		}
+
+		useAccount(user, account)
+
+		fmt.Printf("Using account: path %s, address %s.\n", account.Path, account.Address.Hex())
+	case "list":
+		listAccounts(user)
 	case "balance":
-		if user.MasterKey == nil {
-			fmt.Printf("No master key loaded. Please load it first.")
+		if user.CurrentAddress == nil {
+			fmt.Printf("No current address set. Please set it first.\n")
+			return
+		}
+
+		if user.Chain == nil {
+			fmt.Printf("Blockchain not initialized. Please create genesis block first.\n")
 			return
 		}
 
+		user.Chain.Mu.Lock()
 		balance := user.Chain.GetBalance(user.CurrentAddress.Hex())
+		user.Chain.Mu.Unlock()
 
 		fmt.Printf("Current balance: %s.\n", balance.String())
 	default:
-		fmt.Printf("Usage: wallet <command> [args]\n")
+		fmt.Printf("Usage: wallet <set <idx|path> [label]|use <label|idx>|list|balance>\n")
+		return
+	}
+}
+
+// listAccounts prints the derived accounts with their balance, chain nonce and number of transactions in the mempool
+func listAccounts(user *user.User) {
+	accounts := user.Wallet.Accounts()
+
+	if len(accounts) == 0 {
+		fmt.Printf("No accounts derived. Use 'wallet set <idx|path> [label]' first.\n")
 		return
 	}
+
+	for i, a := range accounts {
+		addr := a.Address.Hex()
+
+		current := " "
+
+		if user.CurrentAddress != nil && *user.CurrentAddress == a.Address {
+			current = "*"
+		}
+
+		label := a.Label
+
+		if label == "" {
+			label = "-"
+		}
+
+		balance, nonce := "-", "-"
+
+		if user.Chain != nil {
+			user.Chain.Mu.Lock()
+			balance = user.Chain.GetBalance(addr).String()
+			nonce = strconv.FormatUint(user.Chain.GetNonce(addr, 0), 10)
+			user.Chain.Mu.Unlock()
+		}
+
+		// The mempool locks the chain itself, so it is queried after the chain lock is released
+		pending := user.MemPool.Count(addr)
+
+		fmt.Printf("%s %d  %s  %s  %s  balance: %s  nonce: %s  pending: %d\n",
+			current, i, label, a.Path, addr, balance, nonce, pending)
+	}
+}
+
+// useAccount makes the account the current sender of transactions and receiver of mining rewards
+func useAccount(user *user.User, account *wallet.Account) {
+	address := account.Address
+
+	user.CurrentPrivKey = account.PrivKey
+	user.CurrentAddress = &address
+}
+
+// parseWalletPath parses an address index in the first account or a full BIP-44 path
+func parseWalletPath(s string) (wallet.DerivationPath, error) {
+	if strings.HasPrefix(s, "m/") {
+		return wallet.ParsePath(s)
+	}
+
+	idx, err := strconv.ParseUint(s, 10, 31)
+
+	if err != nil {
+		return wallet.DerivationPath{}, err
+	}
+
+	return wallet.DefaultPath(uint32(idx)), nil
 }
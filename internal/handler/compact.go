@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/chain/block"
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// blockTxTimeout bounds a single request for missing block transactions
+const blockTxTimeout = 10 * time.Second
+
+// Size limits of requests and responses for missing block transactions
+const (
+	maxBlockTxRequestSize  = 64 * 1024
+	maxBlockTxResponseSize = 4 * 1024 * 1024
+)
+
+// blockTxRequest asks a peer for transactions of a block by their short IDs
+type blockTxRequest struct {
+	Hash     []byte   // Hash of the block the transactions belong to
+	ShortIDs [][]byte // Short IDs of the requested transactions
+}
+
+// blockTxResponse carries the requested transactions the peer could find
+type blockTxResponse struct {
+	Transactions []*tx.Transaction
+}
+
+// blockTxProtocol returns the stream protocol ID for fetching missing block transactions
+func blockTxProtocol(user *user.User) protocol.ID {
+	return user.Config.Network.Protocol("blocktxn", "1.0.0")
+}
+
+// RegisterBlockTxProtocol serves requests for transactions of blocks relayed as compact blocks
+func RegisterBlockTxProtocol(user *user.User) {
+	log := logger.LabChainLogger
+
+	user.Host.SetStreamHandler(blockTxProtocol(user), func(s network.Stream) {
+		defer s.Close()
+
+		p := s.Conn().RemotePeer()
+
+		s.SetDeadline(time.Now().Add(blockTxTimeout))
+
+		var req blockTxRequest
+
+		if err := json.NewDecoder(io.LimitReader(s, maxBlockTxRequestSize)).Decode(&req); err != nil {
+			log.Warnf("failed to read block transaction request from %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		resp := blockTxResponse{Transactions: findBlockTxs(user, req.Hash, req.ShortIDs)}
+
+		if err := json.NewEncoder(s).Encode(&resp); err != nil {
+			log.Warnf("failed to send block transactions to %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		log.Debugf("served %d of %d block transactions to %s", len(resp.Transactions), len(req.ShortIDs), p)
+	})
+}
+
+// findBlockTxs looks up the requested transactions in the block, if known, and in the mempool
+func findBlockTxs(user *user.User, hash []byte, shortIDs [][]byte) []*tx.Transaction {
+	index := user.MemPool.ShortIDIndex()
+
+	if c := user.GetChain(); c != nil {
+		c.Mu.Lock()
+		if blk := c.GetBlockByHash(hash); blk != nil {
+			for _, t := range blk.Transactions {
+				index[string(t.ShortID())] = t
+			}
+		}
+		c.Mu.Unlock()
+	}
+
+	txs := make([]*tx.Transaction, 0, len(shortIDs))
+
+	for _, id := range shortIDs {
+		if t, ok := index[string(id)]; ok {
+			txs = append(txs, t)
+		}
+	}
+
+	return txs
+}
+
+// reconstructCompactBlock rebuilds a full block from a compact block using the mempool,
+// fetching missing transactions from the relaying peer or the block's publisher
+func reconstructCompactBlock(cb *block.CompactBlock, msg *pubsub.Message, user *user.User) (*block.Block, error) {
+	log := logger.LabChainLogger
+
+	index := user.MemPool.ShortIDIndex()
+	lookup := func(id []byte) *tx.Transaction {
+		return index[string(id)]
+	}
+
+	txs, missing := cb.Fill(lookup)
+
+	if len(missing) > 0 {
+		log.Infof("compact block index %d: %d of %d transactions missing, requesting", cb.Index, len(missing), len(cb.ShortIDs))
+
+		for _, p := range []peer.ID{msg.ReceivedFrom, msg.GetFrom()} {
+			if p == user.PeerID {
+				continue
+			}
+
+			fetched, err := requestBlockTxs(user, p, cb.Hash, missing)
+
+			if err != nil {
+				log.Warnf("failed to fetch block transactions from %s: %v", p, err)
+				continue
+			}
+
+			for _, t := range fetched {
+				index[string(t.ShortID())] = t
+			}
+
+			if txs, missing = cb.Fill(lookup); len(missing) == 0 {
+				break
+			}
+		}
+
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%d transactions of block index %d could not be fetched", len(missing), cb.Index)
+		}
+	}
+
+	return cb.ToBlock(txs)
+}
+
+// requestBlockTxs asks the peer for the transactions with the given short IDs
+func requestBlockTxs(user *user.User, p peer.ID, hash []byte, shortIDs [][]byte) ([]*tx.Transaction, error) {
+	ctx, cancel := context.WithTimeout(user.Context, blockTxTimeout)
+	defer cancel()
+
+	s, err := user.Host.NewStream(ctx, p, blockTxProtocol(user))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	s.SetDeadline(time.Now().Add(blockTxTimeout))
+
+	if err := json.NewEncoder(s).Encode(&blockTxRequest{Hash: hash, ShortIDs: shortIDs}); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	if err := s.CloseWrite(); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to close request: %v", err)
+	}
+
+	var resp blockTxResponse
+
+	if err := json.NewDecoder(io.LimitReader(s, maxBlockTxResponseSize)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	// Only keep transactions that were actually requested
+	fetched := make([]*tx.Transaction, 0, len(resp.Transactions))
+
+	for _, t := range resp.Transactions {
+		for _, id := range shortIDs {
+			if bytes.Equal(t.ShortID(), id) {
+				fetched = append(fetched, t)
+				break
+			}
+		}
+	}
+
+	return fetched, nil
+}
@@ -38,22 +38,29 @@ func handleIncomingBlock(block *block.Block, user *user.User) error {
 	return fmt.Errorf("unacceptable block: index %d", block.Index)
 }
 
-// handleIncomingRequestBlock handles incoming block requests and responds with the requested block
+// handleIncomingRequestBlock handles incoming block requests addressed to this node and responds with the chain
 func handleIncomingRequestBlock(blockMsg *block.BlockMessage, user *user.User) error {
 	log := logger.LabChainLogger
 
+	if blockMsg.Target != "" && blockMsg.Target != user.PeerID {
+		log.Debugf("ignoring block request addressed to %s", blockMsg.Target)
+		return nil
+	}
+
 	user.Chain.Mu.Lock()
-	defer user.Chain.Mu.Unlock()
 
 	idx := blockMsg.Idx
 
 	if idx >= uint64(len(user.Chain.Blocks)) {
 		log.Infof("requested block index %d is out of range, current chain length is %d", idx, len(user.Chain.Blocks))
-		log.Infof("requested chain from %s", user.PeerID)
 
-		err := RequestChain(user)
-		return err
+		// Released first, since the request reads the chain itself
+		user.Chain.Mu.Unlock()
+
+		return RequestChain(user)
 	} else {
+		defer user.Chain.Mu.Unlock()
+
 		log.Infof("responding to block request for index %d", idx)
 
 		respMsg := &block.BlockMessage{
@@ -77,8 +84,8 @@ func handleIncomingRequestBlock(blockMsg *block.BlockMessage, user *user.User) e
 	}
 }
 
-// handleIncomingResponseBlock handles incoming block responses
-func handleIncomingResponseBlock(blockMsg *block.BlockMessage, user *user.User) error {
+// handleIncomingResponseBlock handles incoming block responses and reports the transactions moved by the chain update
+func handleIncomingResponseBlock(blockMsg *block.BlockMessage, user *user.User) (*chain.TipChange, error) {
 	log := logger.LabChainLogger
 
 	user.Chain.Mu.Lock()
@@ -86,30 +93,33 @@ func handleIncomingResponseBlock(blockMsg *block.BlockMessage, user *user.User)
 
 	if len(blockMsg.Blocks) == 0 {
 		log.Warnf("received empty block response from %s", user.PeerID)
-		return fmt.Errorf("empty block response")
+		return nil, fmt.Errorf("empty block response")
+	}
+
+	newChain := &chain.Chain{
+		Blocks: blockMsg.Blocks,
 	}
 
 	lastBlock := blockMsg.Blocks[len(blockMsg.Blocks)-1]
+	localWork, remoteWork := user.Chain.TotalWork(), newChain.TotalWork()
 
-	if user.Chain.Blocks[len(user.Chain.Blocks)-1].Index >= lastBlock.Index {
-		log.Infof("received block response with index %d, but current chain index is %d, ignoring", lastBlock.Index, user.Chain.Blocks[len(user.Chain.Blocks)-1].Index)
-		return nil
+	// The chain with the most work wins, which is not always the longest one
+	if remoteWork.Cmp(localWork) <= 0 {
+		log.Infof("received block response with index %d and total work %s, but local total work is %s, ignoring", lastBlock.Index, remoteWork, localWork)
+		return nil, nil
 	} else {
-		log.Infof("received block response with index %d, updating chain", lastBlock.Index)
-
-		newChain := &chain.Chain{
-			Blocks: blockMsg.Blocks,
-		}
+		log.Infof("received block response with index %d and total work %s, updating chain", lastBlock.Index, remoteWork)
 
 		if err := newChain.VerifyChain(user.Chain.Blocks[0]); err != nil {
 			log.Errorf("received invalid chain from %s: %v", user.PeerID, err)
-			return fmt.Errorf("invalid chain received: %v", err)
-		} else {
-			user.Chain.Blocks = newChain.Blocks
-
-			log.Infof("updating chain with blocks from %s", user.PeerID)
+			return nil, fmt.Errorf("invalid chain received: %v", err)
 		}
 
-		return nil
+		change := user.Chain.ReplaceBlocks(newChain.Blocks)
+
+		log.Infof("updating chain with blocks from %s: %d transactions disconnected, %d connected",
+			user.PeerID, len(change.Disconnected), len(change.Connected))
+
+		return change, nil
 	}
 }
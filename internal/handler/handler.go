@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/elecbug/lab-chain/internal/chain"
 	"github.com/elecbug/lab-chain/internal/chain/block"
 	"github.com/elecbug/lab-chain/internal/chain/tx"
 	"github.com/elecbug/lab-chain/internal/logger"
 	"github.com/elecbug/lab-chain/internal/user"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -46,9 +48,14 @@ func RunSubscribeAndCollectTx(user *user.User) {
 				continue
 			}
 
-			if user.Chain != nil {
+			// Released before the mempool is updated, since the mempool takes the chain lock itself
+			if c := user.GetChain(); c != nil {
 				required := new(big.Int).Add(t.Amount, t.Price)
-				balance := user.Chain.GetBalance(t.From)
+
+				c.Mu.Lock()
+				balance := c.GetBalance(t.From)
+				c.Mu.Unlock()
+
 				if balance.Cmp(required) < 0 {
 					log.Warnf("invalid tx: insufficient balance. required: %s, actual: %s", required.String(), balance.String())
 					continue
@@ -104,16 +111,25 @@ func RunSubscribeAndCollectBlock(user *user.User) {
 			case block.BlockMsgTypeBlock:
 				log.Infof("received block: index %d, miner %s", blockMsg.Blocks[0].Index, blockMsg.Blocks[0].Miner)
 
-				if err := handleIncomingBlock(blockMsg.Blocks[0], user); err != nil {
-					log.Warnf("incoming block rejected: %v", err)
-				} else {
-					log.Infof("block accepted into chain: index %d, hash: %x", blockMsg.Blocks[0].Index, blockMsg.Blocks[0].Hash)
+				acceptBlock(blockMsg.Blocks[0], user)
+
+			case block.BlockMsgTypeCompact:
+				log.Infof("received compact block: index %d, miner %s, txs %d", blockMsg.Compact.Index, blockMsg.Compact.Miner, len(blockMsg.Compact.ShortIDs))
+
+				b, err := reconstructCompactBlock(blockMsg.Compact, msg, user)
+
+				if err != nil {
+					log.Warnf("failed to reconstruct compact block, requesting chain: %v", err)
 
-					for _, tx := range blockMsg.Blocks[0].Transactions {
-						user.MemPool.Remove(tx)
+					if err := RequestChain(user); err != nil {
+						log.Warnf("failed to request chain: %v", err)
 					}
+
+					continue
 				}
 
+				acceptBlock(b, user)
+
 			case block.BlockMsgTypeReq:
 				log.Infof("received block request from %s", peer.ID(msg.From))
 
@@ -125,12 +141,43 @@ func RunSubscribeAndCollectBlock(user *user.User) {
 			case block.BlockMsgTypeResp:
 				log.Infof("received block response from %s", peer.ID(msg.From))
 
-				if err := handleIncomingResponseBlock(blockMsg, user); err != nil {
+				change, err := handleIncomingResponseBlock(blockMsg, user)
+
+				if err != nil {
 					log.Warnf("failed to handle block response: %v", err)
-				} else {
+				} else if change != nil {
 					log.Infof("block response handled successfully, chain updated from %s", peer.ID(msg.From))
+
+					applyTipChange(user, change)
 				}
 			}
 		}
 	}()
 }
+
+// acceptBlock appends the block to the chain if valid and removes its transactions from the mempool
+func acceptBlock(b *block.Block, user *user.User) {
+	log := logger.LabChainLogger
+
+	if err := handleIncomingBlock(b, user); err != nil {
+		log.Warnf("incoming block rejected: %v", err)
+	} else {
+		log.Infof("block accepted into chain: index %d, hash: %x", b.Index, b.Hash)
+
+		user.MemPool.ApplyTipChange(nil, b.Transactions)
+	}
+}
+
+// applyTipChange returns the still valid transactions of replaced blocks to the mempool and drops the included ones.
+// It must be called without the chain lock held
+func applyTipChange(user *user.User, change *chain.TipChange) {
+	var restore []*tx.Transaction
+
+	for _, t := range change.Disconnected {
+		if checkTx(user, user.PeerID, t) == pubsub.ValidationAccept {
+			restore = append(restore, t)
+		}
+	}
+
+	user.MemPool.ApplyTipChange(restore, change.Connected)
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	"github.com/elecbug/lab-chain/internal/user/peers"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// HandshakeVersion is the version of the status handshake protocol
+const HandshakeVersion = "1.0.0"
+
+// handshakeTimeout bounds a single status exchange
+const handshakeTimeout = 10 * time.Second
+
+// RegisterHandshake registers the status protocol and performs the handshake on every new connection
+func RegisterHandshake(user *user.User) {
+	log := logger.AppLogger
+
+	h := user.Host
+	proto := user.Config.Network.Protocol("status", HandshakeVersion)
+
+	h.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+
+		p := s.Conn().RemotePeer()
+
+		s.SetDeadline(time.Now().Add(handshakeTimeout))
+
+		var remote peers.Status
+
+		if err := json.NewDecoder(s).Decode(&remote); err != nil {
+			log.Warnf("failed to read status from %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		if err := json.NewEncoder(s).Encode(localStatus(user)); err != nil {
+			log.Warnf("failed to send status to %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		handleStatus(user, p, &remote)
+	})
+
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(n network.Network, conn network.Conn) {
+			// Only the dialing side initiates, so each connection is handshaked once
+			if conn.Stat().Direction == network.DirOutbound {
+				go initiateHandshake(user, proto, conn)
+			}
+		},
+		DisconnectedF: func(n network.Network, conn network.Conn) {
+			if n.Connectedness(conn.RemotePeer()) != network.Connected {
+				user.Statuses.Remove(conn.RemotePeer())
+			}
+		},
+	})
+
+	// Connections made before the protocol was registered are handshaked now
+	for _, conn := range h.Network().Conns() {
+		if conn.Stat().Direction == network.DirOutbound {
+			go initiateHandshake(user, proto, conn)
+		}
+	}
+
+	log.Infof("status handshake registered: %s", proto)
+}
+
+// initiateHandshake opens a status stream to the peer of the connection and exchanges statuses.
+// The handshake also runs over relayed connections, which stay open so hole punching can upgrade them to direct ones
+func initiateHandshake(user *user.User, proto protocol.ID, conn network.Conn) {
+	log := logger.AppLogger
+
+	p := conn.RemotePeer()
+	limited := conn.Stat().Limited
+
+	ctx, cancel := context.WithTimeout(user.Context, handshakeTimeout)
+	defer cancel()
+
+	s, err := user.Host.NewStream(network.WithAllowLimitedConn(ctx, "handshake"), p, proto)
+
+	if err != nil && limited {
+		log.Warnf("handshake with %s over relayed connection failed: %v", p, err)
+		return
+	} else if err != nil {
+		log.Warnf("handshake with %s failed, disconnecting: %v", p, err)
+		user.Host.Network().ClosePeer(p)
+		return
+	}
+	defer s.Close()
+
+	s.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if err := json.NewEncoder(s).Encode(localStatus(user)); err != nil {
+		log.Warnf("failed to send status to %s: %v", p, err)
+		s.Reset()
+		return
+	}
+
+	var remote peers.Status
+
+	if err := json.NewDecoder(s).Decode(&remote); err != nil {
+		log.Warnf("failed to read status from %s: %v", p, err)
+		s.Reset()
+		return
+	}
+
+	handleStatus(user, p, &remote)
+}
+
+// handleStatus checks the compatibility of the peer, records its head and requests the chain if it is ahead
+func handleStatus(user *user.User, p peer.ID, remote *peers.Status) {
+	log := logger.AppLogger
+
+	local := localStatus(user)
+
+	if err := checkCompatible(local, remote); err != nil {
+		log.Warnf("incompatible peer %s, disconnecting: %v", p, err)
+		user.Host.Network().ClosePeer(p)
+		return
+	}
+
+	user.Statuses.Set(p, remote)
+
+	log.Infof("handshake with %s completed: mode %s, head %d, total work %s", p, remote.Mode, remote.HeadHeight, remote.TotalWork)
+
+	if user.GetChain() != nil && remote.TotalWork != nil && remote.TotalWork.Cmp(local.TotalWork) > 0 {
+		log.Infof("peer %s is ahead (head %d, local head %d), requesting chain", p, remote.HeadHeight, local.HeadHeight)
+
+		// Handshakes with several peers ahead are merged into a single request to the one with the most work
+
+		if err := RequestChain(user); err != nil {
+			log.Warnf("failed to request chain: %v", err)
+		}
+	}
+}
+
+// localStatus builds the status of this node from its current chain
+func localStatus(user *user.User) *peers.Status {
+	status := &peers.Status{
+		Version:   HandshakeVersion,
+		NetworkID: user.Config.Network.ID,
+		Mode:      user.Config.Mode,
+		TotalWork: big.NewInt(0),
+	}
+
+	c := user.GetChain()
+
+	if c == nil {
+		return status
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if len(c.Blocks) == 0 {
+		return status
+	}
+
+	head := c.Blocks[len(c.Blocks)-1]
+
+	status.GenesisHash = c.Blocks[0].Hash
+	status.HeadHash = head.Hash
+	status.HeadHeight = head.Index
+	status.TotalWork = c.TotalWork()
+
+	return status
+}
+
+// checkCompatible reports why the remote status is incompatible with the local one, if it is
+func checkCompatible(local, remote *peers.Status) error {
+	if majorVersion(local.Version) != majorVersion(remote.Version) {
+		return fmt.Errorf("protocol version mismatch: local %s, remote %s", local.Version, remote.Version)
+	}
+
+	if local.NetworkID != remote.NetworkID {
+		return fmt.Errorf("network ID mismatch: local %s, remote %s", local.NetworkID, remote.NetworkID)
+	}
+
+	// Nodes without a chain yet cannot be on a different genesis
+	if len(local.GenesisHash) > 0 && len(remote.GenesisHash) > 0 && !bytes.Equal(local.GenesisHash, remote.GenesisHash) {
+		return fmt.Errorf("genesis mismatch: local %x, remote %x", local.GenesisHash, remote.GenesisHash)
+	}
+
+	return nil
+}
+
+// majorVersion returns the major component of a semantic version string
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+
+	return major
+}
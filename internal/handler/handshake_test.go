@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/user"
+	"github.com/elecbug/lab-chain/internal/user/peers"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// TestHandshakeOverRelayUpgradesToDirect connects two nodes through a circuit relay on the loopback interface,
+// checks that the handshake completes without closing the relayed connection,
+// and that the status survives the upgrade to a direct connection, as done by hole punching
+func TestHandshakeOverRelayUpgradesToDirect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := newTestHost(t)
+	dialer := newTestHost(t)
+	listener := newTestHost(t)
+
+	relayUser := newTestUser(ctx, relay)
+	dialerUser := newTestUser(ctx, dialer)
+	listenerUser := newTestUser(ctx, listener)
+
+	svc, err := relayv2.New(relay)
+
+	if err != nil {
+		t.Fatalf("failed to start relay service: %v", err)
+	}
+
+	defer svc.Close()
+
+	// Like the boot node, the relay answers handshakes, otherwise its clients disconnect from it
+	RegisterHandshake(relayUser)
+	RegisterHandshake(dialerUser)
+	RegisterHandshake(listenerUser)
+
+	relayInfo := peer.AddrInfo{ID: relay.ID(), Addrs: relay.Addrs()}
+
+	if err := listener.Connect(ctx, relayInfo); err != nil {
+		t.Fatalf("failed to connect to relay: %v", err)
+	}
+
+	if _, err := client.Reserve(ctx, listener, relayInfo); err != nil {
+		t.Fatalf("failed to reserve a relay slot: %v", err)
+	}
+
+	circuit, err := multiaddr.NewMultiaddr("/p2p/" + relay.ID().String() + "/p2p-circuit")
+
+	if err != nil {
+		t.Fatalf("failed to build circuit address: %v", err)
+	}
+
+	relayed := peer.AddrInfo{ID: listener.ID(), Addrs: []multiaddr.Multiaddr{relay.Addrs()[0].Encapsulate(circuit)}}
+
+	if err := dialer.Connect(ctx, relayed); err != nil {
+		t.Fatalf("failed to connect through relay: %v", err)
+	}
+
+	waitFor(t, "handshake over relayed connection", func() bool {
+		return dialerUser.Statuses.Get(listener.ID()) != nil && listenerUser.Statuses.Get(dialer.ID()) != nil
+	})
+
+	if got := dialer.Network().Connectedness(listener.ID()); got != network.Limited {
+		t.Fatalf("relayed connection not kept open: connectedness %s", got)
+	}
+
+	// Hole punching replaces the relayed connection with a direct one
+	direct := peer.AddrInfo{ID: listener.ID(), Addrs: listener.Addrs()}
+
+	if err := dialer.Connect(network.WithForceDirectDial(ctx, "test"), direct); err != nil {
+		t.Fatalf("failed to connect directly: %v", err)
+	}
+
+	for _, conn := range dialer.Network().ConnsToPeer(listener.ID()) {
+		if conn.Stat().Limited {
+			conn.Close()
+		}
+	}
+
+	waitFor(t, "direct connection", func() bool {
+		return dialer.Network().Connectedness(listener.ID()) == network.Connected
+	})
+
+	if dialerUser.Statuses.Get(listener.ID()) == nil || listenerUser.Statuses.Get(dialer.ID()) == nil {
+		t.Fatalf("status lost when the relayed connection was replaced")
+	}
+}
+
+// newTestHost creates a host listening on the loopback interface
+func newTestHost(t *testing.T, opts ...libp2p.Option) host.Host {
+	t.Helper()
+
+	h, err := libp2p.New(append([]libp2p.Option{libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")}, opts...)...)
+
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+
+	t.Cleanup(func() { h.Close() })
+
+	return h
+}
+
+// newTestUser creates a user without a chain on the host
+func newTestUser(ctx context.Context, h host.Host) *user.User {
+	return &user.User{
+		Context:  ctx,
+		Config:   cfg.Config{Mode: "full", Network: cfg.NetworkConfig{ID: "test"}},
+		PeerID:   h.ID(),
+		Host:     h,
+		Statuses: peers.NewStatusBook(),
+	}
+}
+
+// waitFor polls the condition until it holds or fails the test after a timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
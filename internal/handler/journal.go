@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// RestoreLocalTxs revalidates the journaled local transactions of an earlier run against the current chain,
+// adds those still valid to the mempool and rebroadcasts them
+func RestoreLocalTxs(user *user.User) {
+	log := logger.LabChainLogger
+
+	txs, err := user.MemPool.LoadJournal()
+
+	if err != nil {
+		log.Warnf("failed to load mempool journal: %v", err)
+		return
+	}
+
+	restored := 0
+
+	for _, t := range txs {
+		if checkTx(user, user.PeerID, t) != pubsub.ValidationAccept {
+			log.Infof("journaled tx dropped: from %s, nonce %d no longer valid", t.From, t.Nonce)
+			continue
+		}
+
+		if !user.MemPool.AddLocal(t) {
+			continue
+		}
+
+		if err := BroadcastTx(user, t); err != nil {
+			log.Warnf("failed to rebroadcast journaled tx: %v", err)
+		}
+
+		restored++
+	}
+
+	if err := user.MemPool.RotateJournal(); err != nil {
+		log.Warnf("failed to rotate mempool journal: %v", err)
+	} else {
+		log.Infof("mempool journal restored: %d of %d transactions", restored, len(txs))
+	}
+}
@@ -2,30 +2,78 @@ package handler
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/elecbug/lab-chain/internal/chain/block"
 	"github.com/elecbug/lab-chain/internal/logger"
 	"github.com/elecbug/lab-chain/internal/user"
 )
 
-// RequestChain sends a request to the peer for the entire chain if the requested block index is out of range
+// chainRequestInterval is the minimum time between two chain requests, keeping a syncing node below the request limit of its peers
+const chainRequestInterval = syncRequestWindow / (syncRequestLimit - 1)
+
+// RequestChain requests the entire chain from the connected peer with the most work.
+// Requests are sent at most once per chainRequestInterval, and requests made in between are merged into a single one sent when it ends
 func RequestChain(user *user.User) error {
 	log := logger.LabChainLogger
 
-	if user.Chain == nil {
+	if user.GetChain() == nil {
 		log.Warnf("user chain is nil, cannot request chain")
 		return fmt.Errorf("user chain is nil")
 	}
 
-	if len(user.Chain.Blocks) == 0 {
+	wait, ok := user.Statuses.ScheduleSync(chainRequestInterval)
+
+	if !ok {
+		log.Debugf("chain request already scheduled")
+		return nil
+	}
+
+	if wait <= 0 {
+		return sendChainRequest(user)
+	}
+
+	log.Infof("chain request scheduled in %s", wait.Round(time.Millisecond))
+
+	time.AfterFunc(wait, func() {
+		if err := sendChainRequest(user); err != nil {
+			log.Warnf("failed to request chain: %v", err)
+		}
+	})
+
+	return nil
+}
+
+// sendChainRequest publishes a chain request addressed to the peer with the most work, or to any peer if no status is known.
+// It must be called without the chain lock held
+func sendChainRequest(user *user.User) error {
+	log := logger.LabChainLogger
+
+	user.Statuses.SyncSent()
+
+	if user.Context.Err() != nil {
+		return user.Context.Err()
+	}
+
+	c := user.GetChain()
+
+	c.Mu.Lock()
+	if len(c.Blocks) == 0 {
+		c.Mu.Unlock()
+
 		log.Warnf("user chain is empty, cannot request chain")
 		return fmt.Errorf("user chain is empty")
 	}
 
-	lastBlock := user.Chain.Blocks[len(user.Chain.Blocks)-1]
+	lastBlock := c.Blocks[len(c.Blocks)-1]
+	c.Mu.Unlock()
+
+	target, status := user.Statuses.Best()
+
 	blockMsg := &block.BlockMessage{
-		Type: block.BlockMsgTypeReq,
-		Idx:  lastBlock.Index,
+		Type:   block.BlockMsgTypeReq,
+		Idx:    lastBlock.Index,
+		Target: target,
 	}
 
 	data, err := block.Serialize(blockMsg)
@@ -40,6 +88,11 @@ func RequestChain(user *user.User) error {
 		return err
 	}
 
-	log.Infof("requested chain from peer %s", user.PeerID)
+	if status != nil {
+		log.Infof("requested chain from peer %s: head %d, total work %s", target, status.HeadHeight, status.TotalWork)
+	} else {
+		log.Infof("requested chain from any peer")
+	}
+
 	return nil
 }
@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// txRelayTimeout bounds a single announcement or pull exchange
+const txRelayTimeout = 10 * time.Second
+
+// Size limits of announcement and pull messages
+const (
+	maxTxAnnounceSize     = 64 * 1024
+	maxTxPullResponseSize = 4 * 1024 * 1024
+)
+
+// seenTxTTL is how long announced transaction hashes are remembered to avoid pulling them twice
+const seenTxTTL = 5 * time.Minute
+
+// txHashes is the body of announcement and pull request messages
+type txHashes struct {
+	Hashes [][]byte
+}
+
+// txPullResponse carries the pulled transactions the peer could find
+type txPullResponse struct {
+	Transactions []*tx.Transaction
+}
+
+// txAnnounceProtocol returns the stream protocol ID for transaction hash announcements
+func txAnnounceProtocol(user *user.User) protocol.ID {
+	return user.Config.Network.Protocol("tx-announce", "1.0.0")
+}
+
+// txPullProtocol returns the stream protocol ID for pulling announced transactions
+func txPullProtocol(user *user.User) protocol.ID {
+	return user.Config.Network.Protocol("tx-pull", "1.0.0")
+}
+
+// BroadcastTx relays a locally created transaction using the configured relay mode.
+// It only relays, so the caller stores the transaction in the mempool first, where announced peers pull it from
+func BroadcastTx(user *user.User, t *tx.Transaction) error {
+	switch user.Config.Relay.TxMode {
+	case "announce":
+		announceTxs(user, [][]byte{t.Hash()}, "")
+
+		return nil
+	default:
+		return t.Publish(user.Context, user.TxTopic)
+	}
+}
+
+// RegisterTxRelay serves transaction announcements and pull requests from peers
+func RegisterTxRelay(user *user.User) {
+	log := logger.LabChainLogger
+
+	// Remembers transaction hashes that were already requested or received
+	seen := &seenCache{entries: make(map[string]time.Time)}
+
+	user.Host.SetStreamHandler(txAnnounceProtocol(user), func(s network.Stream) {
+		defer s.Close()
+
+		p := s.Conn().RemotePeer()
+
+		s.SetDeadline(time.Now().Add(txRelayTimeout))
+
+		var ann txHashes
+
+		if err := json.NewDecoder(io.LimitReader(s, maxTxAnnounceSize)).Decode(&ann); err != nil {
+			log.Warnf("failed to read tx announcement from %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		go handleTxAnnouncement(user, seen, p, ann.Hashes)
+	})
+
+	user.Host.SetStreamHandler(txPullProtocol(user), func(s network.Stream) {
+		defer s.Close()
+
+		p := s.Conn().RemotePeer()
+
+		s.SetDeadline(time.Now().Add(txRelayTimeout))
+
+		var req txHashes
+
+		if err := json.NewDecoder(io.LimitReader(s, maxTxAnnounceSize)).Decode(&req); err != nil {
+			log.Warnf("failed to read tx pull request from %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		resp := txPullResponse{Transactions: make([]*tx.Transaction, 0, len(req.Hashes))}
+
+		for _, hash := range req.Hashes {
+			if t := user.MemPool.GetByHash(hash); t != nil {
+				resp.Transactions = append(resp.Transactions, t)
+			}
+		}
+
+		if err := json.NewEncoder(s).Encode(&resp); err != nil {
+			log.Warnf("failed to send pulled txs to %s: %v", p, err)
+			s.Reset()
+			return
+		}
+
+		log.Debugf("served %d of %d pulled txs to %s", len(resp.Transactions), len(req.Hashes), p)
+	})
+}
+
+// handleTxAnnouncement pulls unknown announced transactions, validates them and announces them further
+func handleTxAnnouncement(user *user.User, seen *seenCache, from peer.ID, hashes [][]byte) {
+	log := logger.LabChainLogger
+
+	unknown := make([][]byte, 0, len(hashes))
+
+	for _, hash := range hashes {
+		if user.MemPool.GetByHash(hash) == nil && seen.add(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+
+	log.Debugf("received announcement of %d txs from %s, %d unknown", len(hashes), from, len(unknown))
+
+	if len(unknown) == 0 {
+		return
+	}
+
+	txs, size, err := pullTxs(user, from, unknown)
+
+	if err != nil {
+		log.Warnf("failed to pull txs from %s: %v", from, err)
+
+		// Allow the transactions to be pulled from another announcer
+		for _, hash := range unknown {
+			seen.remove(hash)
+		}
+
+		return
+	}
+
+	log.Infof("pulled %d of %d announced txs from %s (%d bytes)", len(txs), len(unknown), from, size)
+
+	accepted := make([][]byte, 0, len(txs))
+
+	for _, t := range txs {
+		// Only malformed or badly signed transactions are rejected, failures against the local chain are ignored
+		switch checkTx(user, from, t) {
+		case pubsub.ValidationReject:
+			if user.Bans != nil {
+				user.Bans.ReportViolation(from, "invalid pulled transaction")
+			}
+			continue
+		case pubsub.ValidationIgnore:
+			continue
+		}
+
+		if user.MemPool.Add(string(t.Signature), t) {
+			log.Infof("transaction received and stored: %s -> %s, amount: %s", t.From, t.To, t.Amount.String())
+			accepted = append(accepted, t.Hash())
+		}
+	}
+
+	if len(accepted) > 0 {
+		announceTxs(user, accepted, from)
+	}
+}
+
+// announceTxs sends the transaction hashes to all connected peers except the given one
+func announceTxs(user *user.User, hashes [][]byte, except peer.ID) {
+	log := logger.LabChainLogger
+
+	data, err := json.Marshal(&txHashes{Hashes: hashes})
+
+	if err != nil {
+		log.Errorf("failed to serialize tx announcement: %v", err)
+		return
+	}
+
+	targets := 0
+
+	for _, p := range user.Host.Network().Peers() {
+		if p == except {
+			continue
+		}
+
+		targets++
+
+		go func(p peer.ID) {
+			ctx, cancel := context.WithTimeout(user.Context, txRelayTimeout)
+			defer cancel()
+
+			s, err := user.Host.NewStream(ctx, p, txAnnounceProtocol(user))
+
+			if err != nil {
+				log.Debugf("failed to announce txs to %s: %v", p, err)
+				return
+			}
+			defer s.Close()
+
+			s.SetDeadline(time.Now().Add(txRelayTimeout))
+
+			if _, err := s.Write(data); err != nil {
+				log.Debugf("failed to announce txs to %s: %v", p, err)
+				s.Reset()
+			}
+		}(p)
+	}
+
+	log.Infof("announced %d txs to %d peers (%d bytes each)", len(hashes), targets, len(data))
+}
+
+// pullTxs requests the transactions with the given hashes from the peer and returns those that were requested
+func pullTxs(user *user.User, p peer.ID, hashes [][]byte) ([]*tx.Transaction, int, error) {
+	ctx, cancel := context.WithTimeout(user.Context, txRelayTimeout)
+	defer cancel()
+
+	s, err := user.Host.NewStream(ctx, p, txPullProtocol(user))
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	s.SetDeadline(time.Now().Add(txRelayTimeout))
+
+	if err := json.NewEncoder(s).Encode(&txHashes{Hashes: hashes}); err != nil {
+		s.Reset()
+		return nil, 0, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	if err := s.CloseWrite(); err != nil {
+		s.Reset()
+		return nil, 0, fmt.Errorf("failed to close request: %v", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(s, maxTxPullResponseSize))
+
+	if err != nil {
+		s.Reset()
+		return nil, 0, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var resp txPullResponse
+
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	requested := make(map[string]bool, len(hashes))
+
+	for _, hash := range hashes {
+		requested[string(hash)] = true
+	}
+
+	// Only keep transactions that were actually requested, each at most once
+	pulled := make([]*tx.Transaction, 0, len(resp.Transactions))
+
+	for _, t := range resp.Transactions {
+		if t == nil {
+			continue
+		}
+
+		if hash := string(t.Hash()); requested[hash] {
+			delete(requested, hash)
+			pulled = append(pulled, t)
+		}
+	}
+
+	if dropped := len(resp.Transactions) - len(pulled); dropped > 0 {
+		logger.LabChainLogger.Debugf("dropped %d unrequested txs pulled from %s", dropped, p)
+	}
+
+	return pulled, len(data), nil
+}
+
+// seenCache is a set of transaction hashes whose entries expire after seenTxTTL
+type seenCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// add records the hash and reports whether it was not seen before
+func (sc *seenCache) add(hash []byte) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+
+	for k, t := range sc.entries {
+		if now.Sub(t) > seenTxTTL {
+			delete(sc.entries, k)
+		}
+	}
+
+	if _, exists := sc.entries[string(hash)]; exists {
+		return false
+	}
+
+	sc.entries[string(hash)] = now
+
+	return true
+}
+
+// remove forgets the hash
+func (sc *seenCache) remove(hash []byte) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	delete(sc.entries, string(hash))
+}
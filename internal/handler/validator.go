@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/chain"
+	"github.com/elecbug/lab-chain/internal/chain/block"
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxTxMessageSize is the largest transaction message accepted from the network
+const maxTxMessageSize = 4 * 1024
+
+// A peer may publish at most syncRequestLimit chain requests per syncRequestWindow
+const (
+	syncRequestLimit  = 5
+	syncRequestWindow = time.Minute
+)
+
+// RegisterValidators registers the pubsub topic validators for transactions and blocks
+func RegisterValidators(ps *pubsub.PubSub, user *user.User) error {
+	if err := ps.RegisterTopicValidator(user.TxTopic.String(), traceMessages(user, describeTx, reportRejections(user, validateTx(user)))); err != nil {
+		return fmt.Errorf("failed to register transaction validator: %v", err)
+	}
+
+	if err := ps.RegisterTopicValidator(user.BlockTopic.String(), traceMessages(user, describeBlockMsg, reportRejections(user, validateBlock(user)))); err != nil {
+		return fmt.Errorf("failed to register block validator: %v", err)
+	}
+
+	return nil
+}
+
+// reportRejections wraps a validator so that rejected messages count as violations of the forwarding peer
+func reportRejections(user *user.User, val pubsub.ValidatorEx) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		result := val(ctx, from, msg)
+
+		if result == pubsub.ValidationReject && user.Bans != nil {
+			user.Bans.ReportViolation(from, fmt.Sprintf("invalid message on %s", msg.GetTopic()))
+		}
+
+		return result
+	}
+}
+
+// traceMessages wraps a validator so that every new message, local or remote, is correlated to its content in the trace
+func traceMessages(user *user.User, describe func(data []byte) (string, []byte, uint64), val pubsub.ValidatorEx) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if user.Tracer.Enabled() {
+			kind, hash, index := describe(msg.Data)
+			user.Tracer.Correlate(msg, kind, hash, index)
+		}
+
+		return val(ctx, from, msg)
+	}
+}
+
+// describeTx returns the kind and hash of a transaction message
+func describeTx(data []byte) (string, []byte, uint64) {
+	t, err := tx.Deserialize(data)
+
+	if err != nil {
+		return "invalid", nil, 0
+	}
+
+	return "tx", t.Hash(), 0
+}
+
+// describeBlockMsg returns the type, block hash and index of a block message
+func describeBlockMsg(data []byte) (string, []byte, uint64) {
+	msg, err := block.Deserialize(data)
+
+	if err != nil {
+		return "invalid", nil, 0
+	}
+
+	switch {
+	case msg.Type == block.BlockMsgTypeCompact && msg.Compact != nil:
+		return string(msg.Type), msg.Compact.Hash, msg.Compact.Index
+	case len(msg.Blocks) > 0:
+		last := msg.Blocks[len(msg.Blocks)-1]
+		return string(msg.Type), last.Hash, last.Index
+	default:
+		return string(msg.Type), nil, 0
+	}
+}
+
+// validateTx returns a validator that checks size, signature, nonce and balance of incoming transactions
+func validateTx(user *user.User) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		log := logger.LabChainLogger
+
+		// Locally published transactions were already checked when they were created
+		if from == user.PeerID {
+			return pubsub.ValidationAccept
+		}
+
+		if len(msg.Data) > maxTxMessageSize {
+			log.Warnf("rejecting tx from %s: message too large (%d bytes)", from, len(msg.Data))
+			return pubsub.ValidationReject
+		}
+
+		t, err := tx.Deserialize(msg.Data)
+
+		if err != nil {
+			log.Warnf("rejecting tx from %s: %v", from, err)
+			return pubsub.ValidationReject
+		}
+
+		return checkTx(user, from, t)
+	}
+}
+
+// checkTx checks the fields, signature, nonce and balance of a transaction received from the peer.
+// Only structural and signature failures are rejected, checks against the local chain and mempool are ignored
+func checkTx(user *user.User, from peer.ID, t *tx.Transaction) pubsub.ValidationResult {
+	log := logger.LabChainLogger
+
+	if t.From == tx.COINBASE || t.Amount == nil || t.Price == nil || t.Amount.Sign() < 0 || t.Price.Sign() < 0 {
+		log.Warnf("rejecting tx from %s: malformed fields", from)
+		return pubsub.ValidationReject
+	}
+
+	ok, err := t.VerifySignature()
+
+	if err != nil || !ok {
+		log.Warnf("rejecting tx from %s: signature verification failed: %v", from, err)
+		return pubsub.ValidationReject
+	}
+
+	if t.Price.Cmp(big.NewInt(user.Config.Mempool.MinPrice)) < 0 {
+		log.Debugf("ignoring tx from %s: price %s below the minimum relay price %d", from, t.Price.String(), user.Config.Mempool.MinPrice)
+		return pubsub.ValidationIgnore
+	}
+
+	// Checked before taking the chain lock, since the mempool locks the chain itself
+	if required := user.MemPool.ReplacementPrice(t); required != nil && t.Price.Cmp(required) < 0 {
+		log.Debugf("ignoring tx from %s: nonce %d already taken, replacement requires price %s", from, t.Nonce, required.String())
+		return pubsub.ValidationIgnore
+	}
+
+	c := user.GetChain()
+
+	if c == nil {
+		return pubsub.ValidationAccept
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if expected := c.GetNonce(t.From, 0); t.Nonce < expected {
+		log.Debugf("ignoring tx from %s: stale nonce %d, expected at least %d", from, t.Nonce, expected)
+		return pubsub.ValidationIgnore
+	}
+
+	required := new(big.Int).Add(t.Amount, t.Price)
+	balance := c.GetBalance(t.From)
+
+	// The balance depends on the local chain, which may be behind or on another fork, so the peer is not penalized
+	if balance.Cmp(required) < 0 {
+		log.Debugf("ignoring tx from %s: insufficient balance. required: %s, actual: %s", from, required.String(), balance.String())
+		return pubsub.ValidationIgnore
+	}
+
+	return pubsub.ValidationAccept
+}
+
+// validateBlock returns a validator that checks the structure and header validity of incoming block messages
+func validateBlock(user *user.User) pubsub.ValidatorEx {
+	limiter := &requestLimiter{requests: make(map[peer.ID][]time.Time)}
+
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		log := logger.LabChainLogger
+
+		// Local messages may be published while the chain lock is held
+		if from == user.PeerID {
+			return pubsub.ValidationAccept
+		}
+
+		blockMsg, err := block.Deserialize(msg.Data)
+
+		if err != nil {
+			log.Warnf("rejecting block message from %s: %v", from, err)
+			return pubsub.ValidationReject
+		}
+
+		switch blockMsg.Type {
+		case block.BlockMsgTypeBlock:
+			if len(blockMsg.Blocks) != 1 {
+				log.Warnf("rejecting block from %s: expected 1 block, got %d", from, len(blockMsg.Blocks))
+				return pubsub.ValidationReject
+			}
+
+			b := blockMsg.Blocks[0]
+
+			if err := b.VerifyHeader(); err != nil {
+				log.Warnf("rejecting block from %s: index %d: %v", from, b.Index, err)
+				return pubsub.ValidationReject
+			}
+
+			c := user.GetChain()
+
+			// VerifyHeader does not check the proof of work of a genesis block, so it is only known as the local one
+			if b.Index == 0 {
+				return checkGenesis(c, from, b.Hash)
+			}
+
+			if c == nil {
+				return pubsub.ValidationAccept
+			}
+
+			c.Mu.Lock()
+			defer c.Mu.Unlock()
+
+			if c.GetBlockByHash(b.Hash) != nil {
+				log.Debugf("ignoring block from %s: index %d already known", from, b.Index)
+				return pubsub.ValidationIgnore
+			}
+
+			return pubsub.ValidationAccept
+
+		case block.BlockMsgTypeCompact:
+			if blockMsg.Compact == nil {
+				log.Warnf("rejecting compact block from %s: missing body", from)
+				return pubsub.ValidationReject
+			}
+
+			cb := blockMsg.Compact
+
+			if err := cb.VerifyHeader(); err != nil {
+				log.Warnf("rejecting compact block from %s: index %d: %v", from, cb.Index, err)
+				return pubsub.ValidationReject
+			}
+
+			// Genesis blocks are never relayed in compact form
+			if cb.Index == 0 {
+				log.Warnf("rejecting compact block from %s: genesis block", from)
+				return pubsub.ValidationReject
+			}
+
+			c := user.GetChain()
+
+			if c == nil {
+				return pubsub.ValidationAccept
+			}
+
+			c.Mu.Lock()
+			defer c.Mu.Unlock()
+
+			if c.GetBlockByHash(cb.Hash) != nil {
+				log.Debugf("ignoring compact block from %s: index %d already known", from, cb.Index)
+				return pubsub.ValidationIgnore
+			}
+
+			return pubsub.ValidationAccept
+
+		case block.BlockMsgTypeReq:
+			origin := msg.GetFrom()
+
+			if !limiter.allow(origin) {
+				log.Warnf("ignoring block request from %s: too many requests", origin)
+
+				if user.Bans != nil {
+					user.Bans.ReportViolation(origin, "too many chain requests")
+				}
+
+				return pubsub.ValidationIgnore
+			}
+
+			return pubsub.ValidationAccept
+
+		case block.BlockMsgTypeResp:
+			if len(blockMsg.Blocks) == 0 {
+				log.Warnf("rejecting block response from %s: no blocks", from)
+				return pubsub.ValidationReject
+			}
+
+			for _, b := range blockMsg.Blocks {
+				if err := b.VerifyHeader(); err != nil {
+					log.Warnf("rejecting block response from %s: index %d: %v", from, b.Index, err)
+					return pubsub.ValidationReject
+				}
+			}
+
+			return pubsub.ValidationAccept
+
+		default:
+			log.Warnf("rejecting block message from %s: unknown type %s", from, blockMsg.Type)
+			return pubsub.ValidationReject
+		}
+	}
+}
+
+// checkGenesis ignores a remote genesis block matching the local one, or any while there is no local chain to compare with,
+// and rejects all others
+func checkGenesis(c *chain.Chain, from peer.ID, hash []byte) pubsub.ValidationResult {
+	log := logger.LabChainLogger
+
+	if c == nil {
+		log.Debugf("ignoring genesis block from %s: no local chain to compare with", from)
+		return pubsub.ValidationIgnore
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if len(c.Blocks) > 0 && bytes.Equal(c.Blocks[0].Hash, hash) {
+		log.Debugf("ignoring genesis block from %s: already known", from)
+		return pubsub.ValidationIgnore
+	}
+
+	log.Warnf("rejecting block from %s: genesis block %x differs from the local genesis", from, hash)
+	return pubsub.ValidationReject
+}
+
+// requestLimiter counts chain requests per peer within a sliding window
+type requestLimiter struct {
+	mu       sync.Mutex
+	requests map[peer.ID][]time.Time
+}
+
+// allow records a request from the peer and reports whether it is within the limit
+func (rl *requestLimiter) allow(p peer.ID) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	recent := rl.requests[p][:0]
+
+	for _, t := range rl.requests[p] {
+		if now.Sub(t) < syncRequestWindow {
+			recent = append(recent, t)
+		}
+	}
+
+	recent = append(recent, now)
+	rl.requests[p] = recent
+
+	return len(recent) <= syncRequestLimit
+}
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/elecbug/lab-chain/internal/cfg"
 	ipfslog "github.com/ipfs/go-log/v2"
@@ -26,7 +27,7 @@ func InitLogging(h host.Host, cfg cfg.Config) error {
 		Format: ipfslog.JSONOutput,
 		Stdout: false,
 		Stderr: false,
-		File:   "/app/data/log.jsonl",
+		File:   filepath.Join(cfg.DataDir, "log.jsonl"),
 	})
 
 	return nil
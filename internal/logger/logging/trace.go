@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// TraceExporter passes pubsub trace events to the debug log, a trace file and an optional remote collector,
+// and records which block or transaction each message carried
+type TraceExporter struct {
+	tracers []pubsub.EventTracer
+	peerID  peer.ID
+
+	mu  sync.Mutex
+	ids *os.File
+	enc *json.Encoder
+}
+
+// MessageRecord maps a pubsub message ID to the block or transaction it carried
+type MessageRecord struct {
+	Timestamp int64  `json:"timestamp"` // Unix nanoseconds, comparable to trace event timestamps
+	PeerID    []byte `json:"peerID"`    // Tracing node, encoded like the peer IDs of trace events
+	MessageID []byte `json:"messageID"` // Encoded like the message IDs of trace events
+	Topic     string `json:"topic"`
+	Kind      string `json:"kind"`           // e.g., "tx", "BLOCK", "CMPCT", "REQ", "RESP"
+	Hash      string `json:"hash,omitempty"` // Hex hash of the carried block or transaction
+	Index     uint64 `json:"index,omitempty"`
+	Size      int    `json:"size"` // Size of the message data in bytes
+}
+
+// NewTraceExporter creates the trace exporter configured for the node
+func NewTraceExporter(ctx context.Context, h host.Host, cfg cfg.Config) (*TraceExporter, error) {
+	log := logger.AppLogger
+
+	te := &TraceExporter{
+		tracers: []pubsub.EventTracer{&GossipsubTracer{}},
+		peerID:  h.ID(),
+	}
+
+	trace := cfg.PubSub.Trace
+
+	if !trace.Enabled {
+		return te, nil
+	}
+
+	// Traces of earlier runs are kept so that restarted nodes can still be analyzed
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	switch trace.Format {
+	case "json":
+		tracer, err := pubsub.OpenJSONTracer(trace.File, flags, 0644)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file %s: %v", trace.File, err)
+		}
+
+		te.tracers = append(te.tracers, tracer)
+	case "pb":
+		tracer, err := pubsub.OpenPBTracer(trace.File, flags, 0644)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file %s: %v", trace.File, err)
+		}
+
+		te.tracers = append(te.tracers, tracer)
+	default:
+		return nil, fmt.Errorf("unknown trace format: %s", trace.Format)
+	}
+
+	log.Infof("pubsub trace export enabled: %s (%s)", trace.File, trace.Format)
+
+	if trace.Remote != "" {
+		addr, err := multiaddr.NewMultiaddr(trace.Remote)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote tracer address %s: %v", trace.Remote, err)
+		}
+
+		pi, err := peer.AddrInfoFromP2pAddr(addr)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote tracer address %s: %v", trace.Remote, err)
+		}
+
+		tracer, err := pubsub.NewRemoteTracer(ctx, h, *pi)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote tracer: %v", err)
+		}
+
+		te.tracers = append(te.tracers, tracer)
+
+		log.Infof("pubsub trace events are sent to remote collector %s", pi.ID)
+	}
+
+	ids, err := os.OpenFile(trace.IDsFile, flags, 0644)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace ID file %s: %v", trace.IDsFile, err)
+	}
+
+	te.ids = ids
+	te.enc = json.NewEncoder(ids)
+
+	return te, nil
+}
+
+// Trace passes the event to all configured tracers
+func (te *TraceExporter) Trace(evt *pb.TraceEvent) {
+	for _, tracer := range te.tracers {
+		tracer.Trace(evt)
+	}
+}
+
+// Enabled reports whether messages are correlated to blocks and transactions
+func (te *TraceExporter) Enabled() bool {
+	return te != nil && te.ids != nil
+}
+
+// Correlate records the block or transaction carried by the message
+func (te *TraceExporter) Correlate(msg *pubsub.Message, kind string, hash []byte, index uint64) {
+	if !te.Enabled() {
+		return
+	}
+
+	record := &MessageRecord{
+		Timestamp: time.Now().UnixNano(),
+		PeerID:    []byte(te.peerID),
+		MessageID: []byte(msg.ID),
+		Topic:     msg.GetTopic(),
+		Kind:      kind,
+		Index:     index,
+		Size:      len(msg.Data),
+	}
+
+	if hash != nil {
+		record.Hash = hex.EncodeToString(hash)
+	}
+
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	if err := te.enc.Encode(record); err != nil {
+		logger.AppLogger.Warnf("failed to write trace ID record: %v", err)
+	}
+}
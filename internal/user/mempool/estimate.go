@@ -0,0 +1,107 @@
+package mempool
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/elecbug/lab-chain/internal/chain/block"
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+)
+
+// EstimatePrice returns the price that gets a transaction included within target blocks with the given confidence
+// in percent. The history is the lowest price each recent block accepted, where a block with room left accepted
+// the minimum price, and the price is raised above the pending transactions that fill the next target blocks
+func (mp *Mempool) EstimatePrice(recent []*block.Block, target, confidence int) *big.Int {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	minPrice := big.NewInt(mp.config.MinPrice)
+
+	if target < 1 {
+		target = 1
+	}
+
+	// Lowest price included in each block
+	floors := make([]*big.Int, 0, len(recent))
+
+	for _, b := range recent {
+		floor := minPrice
+		count := 0
+
+		var lowest *big.Int
+
+		for _, t := range b.Transactions {
+			if t.From == tx.COINBASE {
+				continue
+			}
+
+			count++
+
+			if lowest == nil || t.Price.Cmp(lowest) < 0 {
+				lowest = t.Price
+			}
+		}
+
+		if count >= block.MaxTxs && lowest.Cmp(floor) > 0 {
+			floor = lowest
+		}
+
+		floors = append(floors, floor)
+	}
+
+	estimate := new(big.Int).Set(minPrice)
+
+	// A price is included within target blocks if it reached the floor of any block in the window
+	if len(floors) >= target {
+		windows := make([]*big.Int, 0, len(floors)-target+1)
+
+		for i := 0; i+target <= len(floors); i++ {
+			cheapest := floors[i]
+
+			for _, floor := range floors[i+1 : i+target] {
+				if floor.Cmp(cheapest) < 0 {
+					cheapest = floor
+				}
+			}
+
+			windows = append(windows, cheapest)
+		}
+
+		sort.Slice(windows, func(i, j int) bool {
+			return windows[i].Cmp(windows[j]) < 0
+		})
+
+		idx := (len(windows)*confidence + 99) / 100
+
+		if idx < 1 {
+			idx = 1
+		} else if idx > len(windows) {
+			idx = len(windows)
+		}
+
+		if windows[idx-1].Cmp(estimate) > 0 {
+			estimate.Set(windows[idx-1])
+		}
+	}
+
+	// Pending transactions paying more are picked first, so the price has to beat the one that fills the target blocks
+	var prices []*big.Int
+
+	for _, l := range mp.pending {
+		for _, t := range l.txs {
+			prices = append(prices, t.Price)
+		}
+	}
+
+	if depth := target * block.MaxTxs; len(prices) >= depth {
+		sort.Slice(prices, func(i, j int) bool {
+			return prices[i].Cmp(prices[j]) > 0
+		})
+
+		if above := new(big.Int).Add(prices[depth-1], big.NewInt(1)); above.Cmp(estimate) > 0 {
+			estimate = above
+		}
+	}
+
+	return estimate
+}
@@ -0,0 +1,99 @@
+package mempool
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
+)
+
+// Entry describes a transaction in the mempool
+type Entry struct {
+	Tx      *tx.Transaction
+	Pending bool      // Executable, otherwise queued after a nonce gap
+	Local   bool      // Submitted on this node
+	Added   time.Time // Arrival time
+}
+
+// Entries returns a snapshot of all transactions in the mempool
+func (mp *Mempool) Entries() []Entry {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	entries := make([]Entry, 0, len(mp.pool))
+
+	for txID, t := range mp.pool {
+		entries = append(entries, mp.entry(txID, t))
+	}
+
+	return entries
+}
+
+// Lookup returns the entry of the transaction with the given hash
+func (mp *Mempool) Lookup(hash []byte) (Entry, bool) {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	for txID, t := range mp.pool {
+		if bytes.Equal(t.Hash(), hash) {
+			return mp.entry(txID, t), true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// Clear removes the transactions received from peers from the mempool and returns how many were removed.
+// Local transactions are kept unless includeLocal is set, in which case they also leave the journal at its next rotation
+func (mp *Mempool) Clear(includeLocal bool) int {
+	log := logger.LabChainLogger
+
+	mp.Mu.Lock()
+	defer mp.Mu.Unlock()
+
+	if includeLocal {
+		n := len(mp.pool)
+
+		mp.pool = make(map[string]*tx.Transaction)
+		mp.added = make(map[string]time.Time)
+		mp.pending = make(map[string]*txList)
+		mp.queued = make(map[string]*txList)
+		mp.locals = make(map[string]bool)
+
+		log.Infof("mempool cleared including local transactions: %d transactions removed", n)
+
+		return n
+	}
+
+	n := 0
+
+	for txID, t := range mp.pool {
+		if mp.locals[txID] {
+			continue
+		}
+
+		mp.drop(t)
+		n++
+	}
+
+	log.Infof("mempool cleared: %d transactions removed, %d local transactions kept", n, len(mp.locals))
+
+	return n
+}
+
+// entry describes the transaction while the lock is held
+func (mp *Mempool) entry(txID string, t *tx.Transaction) Entry {
+	pending := false
+
+	if l, ok := mp.pending[t.From]; ok && l.Get(t.Nonce) == t {
+		pending = true
+	}
+
+	return Entry{
+		Tx:      t,
+		Pending: pending,
+		Local:   mp.locals[txID],
+		Added:   mp.added[txID],
+	}
+}
@@ -0,0 +1,112 @@
+package mempool
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+)
+
+// journal keeps locally submitted transactions in a file, one serialized transaction per line
+type journal struct {
+	file   string
+	writer *os.File
+}
+
+// load reads all transactions of the journal, returning none if it does not exist
+func (j *journal) load() ([]*tx.Transaction, error) {
+	f, err := os.Open(j.file)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open mempool journal %s: %v", j.file, err)
+	}
+
+	defer f.Close()
+
+	var txs []*tx.Transaction
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		t, err := tx.Deserialize(scanner.Bytes())
+
+		if err != nil {
+			// A crash may leave a partially written last line
+			continue
+		}
+
+		txs = append(txs, t)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mempool journal %s: %v", j.file, err)
+	}
+
+	return txs, nil
+}
+
+// insert appends the transaction to the journal
+func (j *journal) insert(t *tx.Transaction) error {
+	if j.writer == nil {
+		f, err := os.OpenFile(j.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+		if err != nil {
+			return fmt.Errorf("failed to open mempool journal %s: %v", j.file, err)
+		}
+
+		j.writer = f
+	}
+
+	data, err := tx.Serialize(t)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write mempool journal %s: %v", j.file, err)
+	}
+
+	return nil
+}
+
+// rotate replaces the journal with the given transactions
+func (j *journal) rotate(txs []*tx.Transaction) error {
+	if j.writer != nil {
+		j.writer.Close()
+		j.writer = nil
+	}
+
+	var data []byte
+
+	for _, t := range txs {
+		line, err := tx.Serialize(t)
+
+		if err != nil {
+			return err
+		}
+
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated journal
+	tmp := j.file + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mempool journal %s: %v", tmp, err)
+	}
+
+	if err := os.Rename(tmp, j.file); err != nil {
+		return fmt.Errorf("failed to replace mempool journal %s: %v", j.file, err)
+	}
+
+	return nil
+}
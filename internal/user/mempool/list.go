@@ -0,0 +1,55 @@
+package mempool
+
+import (
+	"sort"
+
+	"github.com/elecbug/lab-chain/internal/chain/tx"
+)
+
+// txList holds the transactions of a single account keyed by nonce
+type txList struct {
+	txs map[uint64]*tx.Transaction
+}
+
+// newTxList creates an empty transaction list
+func newTxList() *txList {
+	return &txList{txs: make(map[uint64]*tx.Transaction)}
+}
+
+// Len returns the number of transactions in the list
+func (l *txList) Len() int {
+	return len(l.txs)
+}
+
+// Get returns the transaction with the nonce, or nil if there is none
+func (l *txList) Get(nonce uint64) *tx.Transaction {
+	return l.txs[nonce]
+}
+
+// Put stores the transaction under its nonce, replacing any previous one
+func (l *txList) Put(t *tx.Transaction) {
+	l.txs[t.Nonce] = t
+}
+
+// Remove deletes and returns the transaction with the nonce, or nil if there is none
+func (l *txList) Remove(nonce uint64) *tx.Transaction {
+	t := l.txs[nonce]
+	delete(l.txs, nonce)
+
+	return t
+}
+
+// Sorted returns the transactions ordered by nonce
+func (l *txList) Sorted() []*tx.Transaction {
+	txs := make([]*tx.Transaction, 0, len(l.txs))
+
+	for _, t := range l.txs {
+		txs = append(txs, t)
+	}
+
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Nonce < txs[j].Nonce
+	})
+
+	return txs
+}
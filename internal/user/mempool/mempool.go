@@ -1,109 +1,587 @@
 package mempool
 
 import (
+	"bytes"
+	"math/big"
 	"sort"
 	"sync"
+	"time"
 
+	"github.com/elecbug/lab-chain/internal/cfg"
 	"github.com/elecbug/lab-chain/internal/chain/tx"
+	"github.com/elecbug/lab-chain/internal/logger"
 )
 
-// Mempool represents a memory pool for transactions
+// Mempool represents a memory pool for transactions, split per account into a pending lane
+// of executable transactions and a queued lane of transactions waiting for a nonce gap to be filled
 type Mempool struct {
-	Mu   sync.RWMutex
-	pool map[string]*tx.Transaction // key: tx hash or signature
+	Mu          sync.RWMutex
+	pool        map[string]*tx.Transaction // key: signature
+	added       map[string]time.Time       // Arrival time of each transaction, key: signature
+	pending     map[string]*txList         // Executable transactions with nonces contiguous from the account nonce
+	queued      map[string]*txList         // Transactions after a nonce gap
+	locals      map[string]bool            // Transactions submitted on this node, key: signature
+	journal     *journal                   // Keeps local transactions across restarts
+	restored    bool                       // Whether the journal was loaded, so rotating it keeps no earlier transactions
+	stateNonces func(addresses []string) map[string]uint64
+	config      cfg.MempoolConfig
 }
 
-// Add adds a transaction to the mempool if it does not already exist
+// NewMempool creates a new instance of Mempool. stateNonces returns the next nonces of the accounts on the current chain.
+// It is only called while the mempool lock is not held, so it may take the chain lock, but in turn mempool methods
+// that add or re-evaluate transactions must not be called while the chain lock is held
+func NewMempool(config cfg.MempoolConfig, stateNonces func(addresses []string) map[string]uint64) *Mempool {
+	if stateNonces == nil {
+		stateNonces = func([]string) map[string]uint64 { return nil }
+	}
+
+	return &Mempool{
+		pool:        make(map[string]*tx.Transaction),
+		added:       make(map[string]time.Time),
+		pending:     make(map[string]*txList),
+		queued:      make(map[string]*txList),
+		locals:      make(map[string]bool),
+		journal:     &journal{file: config.Journal, writer: nil},
+		restored:    false,
+		stateNonces: stateNonces,
+		config:      config,
+	}
+}
+
+// Add adds a transaction to the pending or queued lane of its account, if it does not already exist,
+// its nonce is not stale and it pays at least the minimum price. A transaction with the same sender and nonce
+// is replaced if the new price exceeds its price by the configured bump. When the sender or the whole mempool
+// is full, the transaction is only added if it pays more than the transaction it evicts
 func (mp *Mempool) Add(txID string, t *tx.Transaction) bool {
+	state := mp.stateNonces([]string{t.From})[t.From]
 
-	if _, exists := mp.pool[txID]; !exists {
-		mp.pool[txID] = t
+	mp.Mu.Lock()
+	defer mp.Mu.Unlock()
 
-		return true
-	} else {
+	return mp.add(txID, t, state)
+}
+
+// AddLocal adds a transaction submitted on this node and records it in the journal
+func (mp *Mempool) AddLocal(t *tx.Transaction) bool {
+	log := logger.LabChainLogger
+
+	state := mp.stateNonces([]string{t.From})[t.From]
+
+	mp.Mu.Lock()
+	defer mp.Mu.Unlock()
+
+	txID := string(t.Signature)
+
+	if !mp.add(txID, t, state) {
 		return false
 	}
-}
 
-// GetBase returns the base count of transactions for a given address
-func (mp *Mempool) GetBase(addr string) int {
-	mp.Mu.RLock()
-	defer mp.Mu.RUnlock()
+	mp.locals[txID] = true
+
+	log.Infof("transaction stored locally: %s -> %s, amount: %s, nonce: %d", t.From, t.To, t.Amount.String(), t.Nonce)
 
-	base := 0
-	for _, tx := range mp.pool {
-		if tx.From == addr {
-			base++
+	if mp.config.Journal != "" {
+		if err := mp.journal.insert(t); err != nil {
+			log.Warnf("failed to journal local tx: %v", err)
 		}
 	}
 
-	return base
+	return true
+}
+
+// LoadJournal returns the local transactions journaled by an earlier run, to be revalidated and added again
+func (mp *Mempool) LoadJournal() ([]*tx.Transaction, error) {
+	mp.Mu.Lock()
+	defer mp.Mu.Unlock()
+
+	if mp.config.Journal == "" || mp.restored {
+		return nil, nil
+	}
+
+	txs, err := mp.journal.load()
+
+	if err != nil {
+		return nil, err
+	}
+
+	mp.restored = true
+
+	return txs, nil
 }
 
-// Sort sorts the transactions in the mempool by nonce
-func (mp *Mempool) Sort() {
+// RotateJournal rewrites the journal with the local transactions still in the mempool
+func (mp *Mempool) RotateJournal() error {
 	mp.Mu.Lock()
 	defer mp.Mu.Unlock()
 
+	// Until the journal was loaded, it still holds the transactions of the earlier run
+	if mp.config.Journal == "" || !mp.restored {
+		return nil
+	}
+
 	var txs []*tx.Transaction
-	for _, tx := range mp.pool {
-		txs = append(txs, tx)
+
+	for txID := range mp.locals {
+		txs = append(txs, mp.pool[txID])
 	}
 
 	sort.Slice(txs, func(i, j int) bool {
-		if txs[i].Nonce == txs[j].Nonce {
-			return txs[i].From < txs[j].From // Secondary sort by sender address if nonces are equal
+		if txs[i].From != txs[j].From {
+			return txs[i].From < txs[j].From
 		}
 
 		return txs[i].Nonce < txs[j].Nonce
 	})
 
-	mp.pool = make(map[string]*tx.Transaction)
-	for _, tx := range txs {
-		mp.pool[string(tx.Signature)] = tx
+	return mp.journal.rotate(txs)
+}
+
+// add adds a transaction while the lock is held, given the account nonce of its sender
+func (mp *Mempool) add(txID string, t *tx.Transaction, state uint64) bool {
+	log := logger.LabChainLogger
+
+	if _, exists := mp.pool[txID]; exists {
+		return false
+	}
+
+	if t.Nonce < state {
+		log.Debugf("stale tx dropped: from %s, nonce %d, account nonce %d", t.From, t.Nonce, state)
+		return false
+	}
+
+	if t.Price.Cmp(big.NewInt(mp.config.MinPrice)) < 0 {
+		log.Debugf("underpriced tx dropped: from %s, nonce %d, price %s, minimum %d", t.From, t.Nonce, t.Price.String(), mp.config.MinPrice)
+		return false
+	}
+
+	if old := mp.get(t.From, t.Nonce); old != nil {
+		if required := mp.replacementPrice(old); t.Price.Cmp(required) < 0 {
+			log.Debugf("tx dropped: from %s, nonce %d already taken, replacement requires price %s, got %s",
+				t.From, t.Nonce, required.String(), t.Price.String())
+			return false
+		}
+
+		mp.removeTx(old)
+
+		log.Infof("tx replaced by fee: from %s, nonce %d, price %s -> %s", t.From, t.Nonce, old.Price.String(), t.Price.String())
+	} else {
+		if mp.config.MaxPerAccount > 0 && mp.count(t.From) >= mp.config.MaxPerAccount {
+			log.Debugf("tx dropped: from %s, nonce %d, account quota of %d transactions exceeded", t.From, t.Nonce, mp.config.MaxPerAccount)
+			return false
+		}
+
+		if mp.config.MaxTxs > 0 && len(mp.pool) >= mp.config.MaxTxs {
+			victim := mp.cheapest()
+
+			if victim == nil || t.Price.Cmp(victim.Price) <= 0 {
+				log.Debugf("tx dropped: from %s, nonce %d, price %s, mempool full with %d transactions", t.From, t.Nonce, t.Price.String(), len(mp.pool))
+				return false
+			}
+
+			mp.evict(victim, "mempool full")
+		}
 	}
+
+	mp.pool[txID] = t
+	mp.added[txID] = time.Now()
+	mp.list(mp.queued, t.From).Put(t)
+	mp.reorganize(t.From, state)
+
+	return true
 }
 
-// NewMempool creates a new instance of Mempool
-func NewMempool() *Mempool {
-	return &Mempool{
-		pool: make(map[string]*tx.Transaction),
+// GetBase returns the number of pending transactions of the address, i.e., the nonce offset of its next transaction
+func (mp *Mempool) GetBase(addr string) int {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	if l, ok := mp.pending[addr]; ok {
+		return l.Len()
+	}
+
+	return 0
+}
+
+// Count returns the number of pending and queued transactions of the address
+func (mp *Mempool) Count(addr string) int {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	return mp.count(addr)
+}
+
+// SelectTxs returns up to count executable transactions with a high total fee,
+// ordered so that the transactions of each account keep their nonce sequence.
+// A cheap transaction is picked when the fees of the transactions it unlocks make up for it.
+// The transactions stay in the mempool until they are removed
+func (mp *Mempool) SelectTxs(count int) []*tx.Transaction {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	lanes := make(map[string][]*tx.Transaction, len(mp.pending))
+
+	for addr, l := range mp.pending {
+		lanes[addr] = l.Sorted()
+	}
+
+	txs := make([]*tx.Transaction, 0, count)
+
+	for len(txs) < count && len(lanes) > 0 {
+		// Pick the nonce sequence prefix with the highest average price among all accounts
+		var bestAddr string
+		var bestLen int
+		var bestAvg *big.Rat
+
+		for addr, lane := range lanes {
+			sum := new(big.Int)
+
+			for i := 0; i < len(lane) && len(txs)+i < count; i++ {
+				sum.Add(sum, lane[i].Price)
+				avg := new(big.Rat).SetFrac(sum, big.NewInt(int64(i+1)))
+
+				if bestAvg == nil || avg.Cmp(bestAvg) > 0 || (avg.Cmp(bestAvg) == 0 && addr < bestAddr) {
+					bestAddr, bestLen, bestAvg = addr, i+1, avg
+				}
+			}
+		}
+
+		txs = append(txs, lanes[bestAddr][:bestLen]...)
+
+		if rest := lanes[bestAddr][bestLen:]; len(rest) > 0 {
+			lanes[bestAddr] = rest
+		} else {
+			delete(lanes, bestAddr)
+		}
+	}
+
+	return txs
+}
+
+// GetByHash returns the transaction with the given hash, or nil if it is not in the mempool
+func (mp *Mempool) GetByHash(hash []byte) *tx.Transaction {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	for _, t := range mp.pool {
+		if bytes.Equal(t.Hash(), hash) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// ShortIDIndex returns the transactions in the mempool keyed by their short ID
+func (mp *Mempool) ShortIDIndex() map[string]*tx.Transaction {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	index := make(map[string]*tx.Transaction, len(mp.pool))
+	for _, t := range mp.pool {
+		index[string(t.ShortID())] = t
 	}
+
+	return index
 }
 
-// PickTopTxs returns the top count transactions from the mempool sorted by price,
-// and removes them from the mempool.
-func (mp *Mempool) PickTopTxs(count int) []*tx.Transaction {
+// Remove deletes a transaction from the mempool and moves later transactions of its account between lanes as needed
+func (mp *Mempool) Remove(tx *tx.Transaction) {
+	state := mp.stateNonces([]string{tx.From})[tx.From]
+
 	mp.Mu.Lock()
 	defer mp.Mu.Unlock()
 
-	// Copy to slice
-	var txs []*tx.Transaction
-	for _, tx := range mp.pool {
-		txs = append(txs, tx)
+	txID := string(tx.Signature)
+
+	if _, exists := mp.pool[txID]; !exists {
+		return
 	}
 
-	// Sort by price descending
-	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].Price.Cmp(txs[j].Price) > 0
-	})
+	mp.removeTx(mp.pool[txID])
+	mp.reorganize(tx.From, state)
+}
+
+// ReplacementPrice returns the minimum price a transaction needs to replace the one with the same sender and nonce,
+// or nil if there is none
+func (mp *Mempool) ReplacementPrice(t *tx.Transaction) *big.Int {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
 
-	if len(txs) > count {
-		txs = txs[:count]
+	if old := mp.get(t.From, t.Nonce); old != nil {
+		return mp.replacementPrice(old)
 	}
 
-	// Remove selected transactions from the pool
-	for _, tx := range txs {
-		delete(mp.pool, string(tx.Signature))
+	return nil
+}
+
+// Expire evicts transactions that stayed in the mempool longer than the configured lifetime
+func (mp *Mempool) Expire() {
+	mp.Mu.Lock()
+	defer mp.Mu.Unlock()
+
+	if mp.config.Lifetime <= 0 {
+		return
 	}
 
-	return txs
+	for txID, t := range mp.pool {
+		if time.Since(mp.added[txID]) > mp.config.Lifetime {
+			mp.evict(t, "expired")
+		}
+	}
 }
 
-// Remove deletes a transaction from the mempool by hash
-func (mp *Mempool) Remove(tx *tx.Transaction) {
+// ApplyTipChange updates the mempool after the chain tip moved. Transactions that entered the chain are dropped,
+// transactions of replaced blocks are added back if their nonce is still open and all accounts are re-evaluated,
+// since account nonces may have moved. The disconnected transactions are expected to be validated by the caller
+func (mp *Mempool) ApplyTipChange(disconnected, connected []*tx.Transaction) {
+	log := logger.LabChainLogger
+
+	accounts := mp.accounts()
+	seen := make(map[string]bool, len(accounts))
+
+	for _, addr := range accounts {
+		seen[addr] = true
+	}
+
+	for _, t := range append(append([]*tx.Transaction{}, disconnected...), connected...) {
+		if !seen[t.From] {
+			seen[t.From] = true
+			accounts = append(accounts, t.From)
+		}
+	}
+
+	// Looked up before taking the lock; accounts added meanwhile were evaluated against the new chain by Add
+	states := mp.stateNonces(accounts)
+
 	mp.Mu.Lock()
 	defer mp.Mu.Unlock()
 
-	delete(mp.pool, string(tx.Signature))
+	for _, t := range connected {
+		if included, ok := mp.pool[string(t.Signature)]; ok {
+			mp.removeTx(included)
+		}
+	}
+
+	restored := 0
+
+	for _, t := range disconnected {
+		if mp.add(string(t.Signature), t, states[t.From]) {
+			restored++
+		}
+	}
+
+	for _, addr := range accounts {
+		mp.reorganize(addr, states[addr])
+	}
+
+	if len(disconnected) > 0 {
+		log.Infof("mempool updated after reorg: %d connected, %d of %d disconnected transactions restored",
+			len(connected), restored, len(disconnected))
+	}
+}
+
+// accounts returns the senders of all transactions in the mempool
+func (mp *Mempool) accounts() []string {
+	mp.Mu.RLock()
+	defer mp.Mu.RUnlock()
+
+	seen := make(map[string]bool)
+	accounts := make([]string, 0, len(mp.pending)+len(mp.queued))
+
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		for addr := range lanes {
+			if !seen[addr] {
+				seen[addr] = true
+				accounts = append(accounts, addr)
+			}
+		}
+	}
+
+	return accounts
+}
+
+// reorganize drops stale transactions of the account given its account nonce, promotes transactions
+// whose nonce gap was filled and demotes pending transactions that are no longer executable
+func (mp *Mempool) reorganize(addr string, next uint64) {
+	log := logger.LabChainLogger
+
+	var txs []*tx.Transaction
+	wasPending := make(map[*tx.Transaction]bool)
+
+	if l, ok := mp.pending[addr]; ok {
+		for _, t := range l.Sorted() {
+			wasPending[t] = true
+			txs = append(txs, t)
+		}
+	}
+
+	if l, ok := mp.queued[addr]; ok {
+		txs = append(txs, l.Sorted()...)
+	}
+
+	delete(mp.pending, addr)
+	delete(mp.queued, addr)
+
+	all := newTxList()
+
+	for _, t := range txs {
+		all.Put(t)
+	}
+
+	promoted, demoted := 0, 0
+
+	for _, t := range all.Sorted() {
+		switch {
+		case t.Nonce < next:
+			// Already included in the chain
+			delete(mp.pool, string(t.Signature))
+			delete(mp.added, string(t.Signature))
+			delete(mp.locals, string(t.Signature))
+			log.Debugf("stale tx removed from mempool: from %s, nonce %d", addr, t.Nonce)
+		case t.Nonce == next:
+			mp.list(mp.pending, addr).Put(t)
+			next++
+
+			if !wasPending[t] {
+				promoted++
+			}
+		default:
+			mp.list(mp.queued, addr).Put(t)
+
+			if wasPending[t] {
+				demoted++
+			}
+		}
+	}
+
+	if promoted > 0 || demoted > 0 {
+		log.Debugf("mempool lanes of %s updated: %d promoted, %d demoted", addr, promoted, demoted)
+	}
+}
+
+// replacementPrice returns the minimum price that replaces the transaction, at least one more than its price
+func (mp *Mempool) replacementPrice(old *tx.Transaction) *big.Int {
+	required := new(big.Int).Mul(old.Price, big.NewInt(100+int64(mp.config.PriceBump)))
+	required.Add(required, big.NewInt(99))
+	required.Div(required, big.NewInt(100))
+
+	if minimum := new(big.Int).Add(old.Price, big.NewInt(1)); required.Cmp(minimum) < 0 {
+		required = minimum
+	}
+
+	return required
+}
+
+// cheapest returns the lowest priced transaction among the last ones of every account,
+// so that evicting it never opens a nonce gap, or nil if the mempool is empty
+func (mp *Mempool) cheapest() *tx.Transaction {
+	var victim *tx.Transaction
+
+	accounts := make(map[string]*tx.Transaction)
+
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		for addr, l := range lanes {
+			for _, t := range l.txs {
+				if last, ok := accounts[addr]; !ok || t.Nonce > last.Nonce {
+					accounts[addr] = t
+				}
+			}
+		}
+	}
+
+	for _, t := range accounts {
+		if victim == nil || t.Price.Cmp(victim.Price) < 0 {
+			victim = t
+		}
+	}
+
+	return victim
+}
+
+// evict removes the transaction, logging the reason, and demotes the later pending transactions of its account,
+// which are no longer executable. The account nonce is not needed, since removing a transaction never fills a gap
+func (mp *Mempool) evict(t *tx.Transaction, reason string) {
+	log := logger.LabChainLogger
+
+	mp.drop(t)
+
+	log.Infof("tx evicted from mempool: reason: %s, hash: %x, from %s, nonce %d, price %s",
+		reason, t.Hash(), t.From, t.Nonce, t.Price.String())
+}
+
+// drop removes the transaction and demotes the later pending transactions of its account, which now follow a nonce gap
+func (mp *Mempool) drop(t *tx.Transaction) {
+	pending := false
+
+	if l, ok := mp.pending[t.From]; ok && l.Get(t.Nonce) == t {
+		pending = true
+	}
+
+	mp.removeTx(t)
+
+	if l, ok := mp.pending[t.From]; ok && pending {
+		for _, later := range l.Sorted() {
+			if later.Nonce > t.Nonce {
+				l.Remove(later.Nonce)
+				mp.list(mp.queued, t.From).Put(later)
+			}
+		}
+	}
+
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		if l, ok := lanes[t.From]; ok && l.Len() == 0 {
+			delete(lanes, t.From)
+		}
+	}
+}
+
+// count returns the number of transactions of the account in both lanes
+func (mp *Mempool) count(addr string) int {
+	n := 0
+
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		if l, ok := lanes[addr]; ok {
+			n += l.Len()
+		}
+	}
+
+	return n
+}
+
+// removeTx deletes the transaction from the pool and the lanes without re-evaluating its account
+func (mp *Mempool) removeTx(t *tx.Transaction) {
+	delete(mp.pool, string(t.Signature))
+	delete(mp.added, string(t.Signature))
+	delete(mp.locals, string(t.Signature))
+
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		if l, ok := lanes[t.From]; ok && l.Get(t.Nonce) == t {
+			l.Remove(t.Nonce)
+		}
+	}
+}
+
+// get returns the transaction of the account with the nonce from either lane, or nil
+func (mp *Mempool) get(addr string, nonce uint64) *tx.Transaction {
+	for _, lanes := range []map[string]*txList{mp.pending, mp.queued} {
+		if l, ok := lanes[addr]; ok {
+			if t := l.Get(nonce); t != nil {
+				return t
+			}
+		}
+	}
+
+	return nil
+}
+
+// list returns the list of the account in the lane, creating it if needed
+func (mp *Mempool) list(lanes map[string]*txList, addr string) *txList {
+	l, ok := lanes[addr]
+
+	if !ok {
+		l = newTxList()
+		lanes[addr] = l
+	}
+
+	return l
 }
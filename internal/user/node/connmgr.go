@@ -0,0 +1,104 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	basicconnmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
+)
+
+// Protection tags used with the connection manager
+const (
+	bootstrapProtectTag = "bootstrap"
+	meshProtectTag      = "mesh"
+)
+
+// getConnManager creates a connection manager with the configured watermarks and grace period
+func getConnManager(cfg cfg.Config) (connmgr.ConnManager, error) {
+	cm := cfg.Network.ConnManager
+
+	mgr, err := basicconnmgr.NewConnManager(cm.LowWater, cm.HighWater, basicconnmgr.WithGracePeriod(cm.GracePeriod))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection manager: %v", err)
+	} else {
+		logger.AppLogger.Infof("connection manager created successfully with watermarks: low %d, high %d, grace period %s",
+			cm.LowWater, cm.HighWater, cm.GracePeriod)
+	}
+
+	return mgr, nil
+}
+
+// meshProtector protects gossipsub mesh peers from being trimmed by the connection manager
+type meshProtector struct {
+	mu     sync.Mutex
+	cm     connmgr.ConnManager
+	topics map[string]bool
+}
+
+// newMeshProtector creates a mesh protector for the given connection manager
+func newMeshProtector(cm connmgr.ConnManager) *meshProtector {
+	return &meshProtector{
+		cm:     cm,
+		topics: make(map[string]bool),
+	}
+}
+
+// meshTag returns the protection tag of the mesh of a topic
+func meshTag(topic string) string {
+	return fmt.Sprintf("%s:%s", meshProtectTag, topic)
+}
+
+// Join records the joined topic
+func (mp *meshProtector) Join(topic string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.topics[topic] = true
+}
+
+// Leave forgets the abandoned topic
+func (mp *meshProtector) Leave(topic string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	delete(mp.topics, topic)
+}
+
+// Graft protects the peer while it is in the mesh of the topic
+func (mp *meshProtector) Graft(p peer.ID, topic string) {
+	mp.cm.Protect(p, meshTag(topic))
+}
+
+// Prune removes the mesh protection of the peer for the topic
+func (mp *meshProtector) Prune(p peer.ID, topic string) {
+	mp.cm.Unprotect(p, meshTag(topic))
+}
+
+// RemovePeer removes the mesh protection of the peer for all topics
+func (mp *meshProtector) RemovePeer(p peer.ID) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for topic := range mp.topics {
+		mp.cm.Unprotect(p, meshTag(topic))
+	}
+}
+
+// The remaining pubsub.RawTracer events are not relevant for mesh protection
+func (mp *meshProtector) AddPeer(peer.ID, protocol.ID)          {}
+func (mp *meshProtector) ValidateMessage(*pubsub.Message)       {}
+func (mp *meshProtector) DeliverMessage(*pubsub.Message)        {}
+func (mp *meshProtector) RejectMessage(*pubsub.Message, string) {}
+func (mp *meshProtector) DuplicateMessage(*pubsub.Message)      {}
+func (mp *meshProtector) ThrottlePeer(peer.ID)                  {}
+func (mp *meshProtector) RecvRPC(*pubsub.RPC)                   {}
+func (mp *meshProtector) SendRPC(*pubsub.RPC, peer.ID)          {}
+func (mp *meshProtector) DropRPC(*pubsub.RPC, peer.ID)          {}
+func (mp *meshProtector) UndeliverableMessage(*pubsub.Message)  {}
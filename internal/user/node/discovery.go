@@ -0,0 +1,132 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	kaddht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+)
+
+// dialTimeout bounds a single connection attempt to a discovered peer
+const dialTimeout = 10 * time.Second
+
+// runDiscovery advertises the node under its network ID and keeps dialing discovered peers
+func runDiscovery(ctx context.Context, h host.Host, dht *kaddht.IpfsDHT, cfg cfg.Config) {
+	log := logger.AppLogger
+
+	rd := drouting.NewRoutingDiscovery(dht)
+
+	dutil.Advertise(ctx, rd, cfg.Network.ID)
+
+	log.Infof("advertising under rendezvous namespace %s", cfg.Network.ID)
+
+	go func() {
+		ticker := time.NewTicker(cfg.DHT.DiscoveryInterval)
+		defer ticker.Stop()
+
+		for {
+			findPeers(ctx, h, rd, cfg)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// findPeers searches the rendezvous namespace of the network ID and connects to new peers up to the configured maximum
+func findPeers(ctx context.Context, h host.Host, rd *drouting.RoutingDiscovery, cfg cfg.Config) {
+	log := logger.AppLogger
+
+	peerCh, err := rd.FindPeers(ctx, cfg.Network.ID)
+
+	if err != nil {
+		log.Debugf("failed to find peers: %v", err)
+		return
+	}
+
+	for p := range peerCh {
+		if len(h.Network().Peers()) >= cfg.Network.MaxPeers {
+			log.Debugf("maximum number of peers reached: %d", cfg.Network.MaxPeers)
+			continue
+		}
+
+		if !shouldDial(h, p) {
+			continue
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+		err := h.Connect(dialCtx, p)
+		cancel()
+
+		if err != nil {
+			log.Debugf("failed to connect to discovered peer %s: %v", p.ID, err)
+		} else {
+			log.Infof("connected to discovered peer: %s", p.ID)
+		}
+	}
+}
+
+// setMDNS starts the mDNS discovery service when it is enabled in the configuration
+func setMDNS(ctx context.Context, h host.Host, cfg cfg.Config) error {
+	log := logger.AppLogger
+
+	if !cfg.MDNS.Enabled {
+		return nil
+	}
+
+	service := mdns.NewMdnsService(h, cfg.MDNS.ServiceTag, &mdnsNotifee{ctx: ctx, h: h, cfg: cfg})
+
+	if err := service.Start(); err != nil {
+		return fmt.Errorf("failed to start mDNS service: %v", err)
+	} else {
+		log.Infof("mDNS discovery started with service tag %s", cfg.MDNS.ServiceTag)
+	}
+
+	return nil
+}
+
+// mdnsNotifee connects to lab-chain peers announced on the local network
+type mdnsNotifee struct {
+	ctx context.Context
+	h   host.Host
+	cfg cfg.Config
+}
+
+// HandlePeerFound implements the mdns.Notifee interface
+func (n *mdnsNotifee) HandlePeerFound(p peer.AddrInfo) {
+	log := logger.AppLogger
+
+	if len(n.h.Network().Peers()) >= n.cfg.Network.MaxPeers || !shouldDial(n.h, p) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(n.ctx, dialTimeout)
+		defer cancel()
+
+		if err := n.h.Connect(ctx, p); err != nil {
+			log.Debugf("failed to connect to mDNS peer %s: %v", p.ID, err)
+		} else {
+			log.Infof("connected to mDNS peer: %s", p.ID)
+		}
+	}()
+}
+
+// shouldDial reports whether the discovered peer is a new, dialable peer
+func shouldDial(h host.Host, p peer.AddrInfo) bool {
+	return p.ID != h.ID() &&
+		len(p.Addrs) > 0 &&
+		h.Network().Connectedness(p.ID) != network.Connected
+}
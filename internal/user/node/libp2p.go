@@ -3,10 +3,11 @@ package node
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/elecbug/lab-chain/internal/cfg"
 	"github.com/elecbug/lab-chain/internal/logger"
-	"github.com/elecbug/lab-chain/internal/logger/logging"
+	"github.com/elecbug/lab-chain/internal/user/peers"
 	"github.com/libp2p/go-libp2p"
 	kaddht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -14,16 +15,20 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
 	"github.com/multiformats/go-multiaddr"
 )
 
 // setLibp2pHost creates a new libp2p host with the provided configuration
-func setLibp2pHost(cfg cfg.Config, priv crypto.PrivKey) (host.Host, error) {
+func setLibp2pHost(cfg cfg.Config, priv crypto.PrivKey, bans *peers.BanList) (host.Host, error) {
 	// Create a new libp2p host with the provided configuration
 	rm, err := getResourceManager(cfg)
 
@@ -31,14 +36,71 @@ func setLibp2pHost(cfg cfg.Config, priv crypto.PrivKey) (host.Host, error) {
 		return nil, fmt.Errorf("failed to create resource manager: %v", err)
 	}
 
-	h, err := libp2p.New(
-		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/%s/tcp/%d", cfg.Network.IPAddress, 12000)),
+	cm, err := getConnManager(cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection manager: %v", err)
+	}
+
+	transports, err := getTransports(cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transports: %v", err)
+	}
+
+	opts := []libp2p.Option{
+		libp2p.ListenAddrStrings(cfg.Network.ListenAddrs...),
 		libp2p.Security(noise.ID, noise.New),
 		libp2p.Muxer(yamux.ID, yamux.DefaultTransport),
-		libp2p.Transport(tcp.NewTCPTransport),
 		libp2p.ResourceManager(rm),
+		libp2p.ConnectionManager(cm),
+		libp2p.ConnectionGater(bans),
 		libp2p.Identity(priv),
-	)
+	}
+	opts = append(opts, transports...)
+
+	natOpts, err := getNATOptions(cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure NAT traversal: %v", err)
+	}
+
+	opts = append(opts, natOpts...)
+
+	if cfg.Network.SwarmKey != "" {
+		psk, err := loadSwarmKey(cfg.Network.SwarmKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to load swarm key: %v", err)
+		} else {
+			logger.AppLogger.Infof("private network enabled with swarm key %s", cfg.Network.SwarmKey)
+		}
+
+		opts = append(opts, libp2p.PrivateNetwork(psk))
+	}
+
+	if len(cfg.Network.AnnounceAddrs) > 0 {
+		announce, err := parseMultiaddrs(cfg.Network.AnnounceAddrs)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse announce addresses: %v", err)
+		}
+
+		opts = append(opts, libp2p.AddrsFactory(func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			result := append([]multiaddr.Multiaddr{}, announce...)
+
+			// Relayed addresses stay reachable through the relay regardless of the announced ones
+			for _, addr := range addrs {
+				if _, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+					result = append(result, addr)
+				}
+			}
+
+			return result
+		}))
+	}
+
+	h, err := libp2p.New(opts...)
 
 	identify.NewIDService(h)
 
@@ -51,6 +113,59 @@ func setLibp2pHost(cfg cfg.Config, priv crypto.PrivKey) (host.Host, error) {
 	return h, nil
 }
 
+// getTransports returns the libp2p transport options enabled in the configuration
+func getTransports(cfg cfg.Config) ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+
+	for _, t := range cfg.Network.Transports {
+		switch t {
+		case "tcp":
+			opts = append(opts, libp2p.Transport(tcp.NewTCPTransport))
+		case "quic":
+			if cfg.Network.SwarmKey != "" {
+				return nil, fmt.Errorf("quic transport does not support private networks")
+			}
+
+			opts = append(opts, libp2p.Transport(quic.NewTransport))
+		case "ws":
+			opts = append(opts, libp2p.Transport(websocket.New))
+		default:
+			return nil, fmt.Errorf("unknown transport: %s", t)
+		}
+	}
+
+	return opts, nil
+}
+
+// loadSwarmKey reads a pre-shared key in the go-libp2p swarm key format
+func loadSwarmKey(file string) (pnet.PSK, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open swarm key file: %v", err)
+	}
+	defer f.Close()
+
+	return pnet.DecodeV1PSK(f)
+}
+
+// parseMultiaddrs parses a list of multiaddr strings
+func parseMultiaddrs(addrs []string) ([]multiaddr.Multiaddr, error) {
+	result := make([]multiaddr.Multiaddr, 0, len(addrs))
+
+	for _, a := range addrs {
+		addr, err := multiaddr.NewMultiaddr(a)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %s: %v", a, err)
+		}
+
+		result = append(result, addr)
+	}
+
+	return result, nil
+}
+
 // getResourceManager configures the resource manager for the libp2p host
 func getResourceManager(cfg cfg.Config) (network.ResourceManager, error) {
 	// Set up resource limits based on the configuration
@@ -81,7 +196,7 @@ func setKadDHT(ctx context.Context, h host.Host, cfg cfg.Config) (*kaddht.IpfsDH
 	// Create a new Kademlia DHT instance with the provided host and configuration
 	dht, err := kaddht.New(ctx, h,
 		kaddht.Mode(getKadMode(cfg)),
-		kaddht.ProtocolPrefix("/lab-chain-dht/1.0.0"),
+		kaddht.ProtocolPrefix(protocol.ID(fmt.Sprintf("/%s-dht/1.0.0", cfg.Network.ID))),
 		kaddht.BucketSize(20),
 	)
 
@@ -105,6 +220,8 @@ func setKadDHT(ctx context.Context, h host.Host, cfg cfg.Config) (*kaddht.IpfsDH
 			continue
 		}
 
+		h.ConnManager().Protect(peerInfo.ID, bootstrapProtectTag)
+
 		err = h.Connect(ctx, *peerInfo)
 
 		if err != nil {
@@ -139,34 +256,46 @@ func getKadMode(cfg cfg.Config) kaddht.ModeOpt {
 	}
 }
 
-// setGossipSub initializes the GossipSub pubsub topics for block and transaction propagation
-func setGossipSub(ctx context.Context, h host.Host) (*pubsub.Topic, *pubsub.Topic, error) {
-	ps, err := pubsub.NewGossipSub(ctx, h,
-		pubsub.WithEventTracer(&logging.GossipsubTracer{}),
+// setGossipSub initializes the configured pubsub router and topics for block and transaction propagation
+func setGossipSub(ctx context.Context, h host.Host, cfg cfg.Config, bans *peers.BanList, book *peers.AddressBook, tracer pubsub.EventTracer) (*pubsub.PubSub, *pubsub.Topic, *pubsub.Topic, error) {
+	opts := []pubsub.Option{
+		pubsub.WithEventTracer(tracer),
+		pubsub.WithRawTracer(newMeshProtector(h.ConnManager())),
 		pubsub.WithMessageSigning(true),
-	)
+	}
+
+	if cfg.PubSub.Score.Enabled && cfg.PubSub.Router != "gossipsub" {
+		logger.AppLogger.Warnf("peer scoring requires the gossipsub router, disabled for %s", cfg.PubSub.Router)
+	} else if cfg.PubSub.Score.Enabled {
+		opts = append(opts,
+			pubsub.WithPeerScore(getPeerScoreParams(cfg), getPeerScoreThresholds()),
+			pubsub.WithPeerScoreInspect(inspectPeerScores(bans, book), scoreInspectPeriod),
+		)
+	}
+
+	ps, err := newPubSub(ctx, h, cfg, opts)
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create gossipsub: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to create pubsub: %v", err)
 	} else {
-		logger.AppLogger.Infof("gossipsub created successfully")
+		logger.AppLogger.Infof("pubsub created successfully")
 	}
 
-	blockTopic, err := ps.Join("lab-chain-blocks")
+	blockTopic, err := ps.Join(cfg.Network.Topic("blocks"))
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to join block topic: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to join block topic: %v", err)
 	} else {
 		logger.AppLogger.Infof("joined block topic successfully")
 	}
 
-	txTopic, err := ps.Join("lab-chain-transactions")
+	txTopic, err := ps.Join(cfg.Network.Topic("transactions"))
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to join transaction topic: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to join transaction topic: %v", err)
 	} else {
 		logger.AppLogger.Infof("joined transaction topic successfully")
 	}
 
-	return blockTopic, txTopic, nil
+	return ps, blockTopic, txTopic, nil
 }
@@ -0,0 +1,52 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user"
+	"github.com/elecbug/lab-chain/internal/user/mempool"
+)
+
+// mempoolMaintenanceInterval is how often expired transactions are evicted and the journal is rewritten
+const mempoolMaintenanceInterval = time.Minute
+
+// setMempool creates the mempool of the user, evicts expired transactions and compacts the journal in the background
+func setMempool(ctx context.Context, cfg cfg.Config, user *user.User) {
+	log := logger.AppLogger
+
+	// The mempool orders transactions by the account nonces of the current chain
+	user.MemPool = mempool.NewMempool(cfg.Mempool, func(addresses []string) map[string]uint64 {
+		c := user.GetChain()
+
+		if c == nil {
+			return nil
+		}
+
+		c.Mu.Lock()
+		defer c.Mu.Unlock()
+
+		return c.GetNonces(addresses)
+	})
+
+	go func() {
+		ticker := time.NewTicker(mempoolMaintenanceInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			user.MemPool.Expire()
+
+			if err := user.MemPool.RotateJournal(); err != nil {
+				log.Warnf("failed to rotate mempool journal: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// getNATOptions returns the libp2p options for relaying, reachability detection and hole punching
+func getNATOptions(cfg cfg.Config) ([]libp2p.Option, error) {
+	log := logger.AppLogger
+
+	nat := cfg.NAT
+
+	var opts []libp2p.Option
+
+	if nat.RelayService {
+		opts = append(opts, libp2p.EnableRelayService())
+
+		log.Infof("circuit relay v2 service enabled")
+	}
+
+	if nat.RelayClient {
+		relays, err := parseAddrInfos(nat.StaticRelays)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse static relays: %v", err)
+		}
+
+		if len(relays) == 0 {
+			return nil, fmt.Errorf("relay client requires static relays or bootstrap peers")
+		}
+
+		opts = append(opts, libp2p.EnableRelay(), libp2p.EnableAutoRelayWithStaticRelays(relays))
+
+		log.Infof("relay client enabled with %d static relays", len(relays))
+	}
+
+	if nat.AutoNAT {
+		opts = append(opts, libp2p.EnableNATService())
+
+		log.Infof("AutoNAT service enabled")
+	}
+
+	if nat.HolePunching {
+		opts = append(opts, libp2p.EnableHolePunching())
+
+		log.Infof("DCUtR hole punching enabled")
+	}
+
+	if nat.PortMap {
+		opts = append(opts, libp2p.NATPortMap())
+
+		log.Infof("NAT port mapping enabled")
+	}
+
+	switch nat.Reachability {
+	case "":
+	case "public":
+		opts = append(opts, libp2p.ForceReachabilityPublic())
+	case "private":
+		opts = append(opts, libp2p.ForceReachabilityPrivate())
+	default:
+		return nil, fmt.Errorf("unknown reachability: %s", nat.Reachability)
+	}
+
+	return opts, nil
+}
+
+// parseAddrInfos parses multiaddrs with peer IDs, merging the addresses of the same peer
+func parseAddrInfos(addrs []string) ([]peer.AddrInfo, error) {
+	maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+
+	for _, a := range addrs {
+		addr, err := multiaddr.NewMultiaddr(a)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %s: %v", a, err)
+		}
+
+		maddrs = append(maddrs, addr)
+	}
+
+	return peer.AddrInfosFromP2pAddrs(maddrs...)
+}
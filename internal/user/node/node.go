@@ -6,10 +6,11 @@ import (
 
 	"github.com/elecbug/lab-chain/internal/cfg"
 	"github.com/elecbug/lab-chain/internal/cli"
+	"github.com/elecbug/lab-chain/internal/handler"
 	"github.com/elecbug/lab-chain/internal/logger"
 	"github.com/elecbug/lab-chain/internal/logger/logging"
 	"github.com/elecbug/lab-chain/internal/user"
-	"github.com/elecbug/lab-chain/internal/user/mempool"
+	"github.com/elecbug/lab-chain/internal/user/peers"
 	"github.com/libp2p/go-libp2p/core/crypto"
 )
 
@@ -17,7 +18,9 @@ import (
 func InitGeneralNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) error {
 	log := logger.AppLogger
 
-	h, err := setLibp2pHost(cfg, priv)
+	bans := peers.NewBanList(cfg.Ban.Threshold, cfg.Ban.Duration)
+
+	h, err := setLibp2pHost(cfg, priv, bans)
 
 	logging.InitLogging(h, cfg)
 
@@ -28,14 +31,34 @@ func InitGeneralNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) e
 		return fmt.Errorf("failed to create libp2p host: %v", err)
 	}
 
+	bans.SetHost(h)
+
 	// Set up the Kademlia DHT for peer discovery and routing
-	_, err = setKadDHT(ctx, h, cfg)
+	dht, err := setKadDHT(ctx, h, cfg)
 
 	if err != nil {
 		return fmt.Errorf("failed to create Kademlia DHT: %v", err)
 	}
 
-	blkTopic, txTopic, err := setGossipSub(ctx, h)
+	runDiscovery(ctx, h, dht, cfg)
+
+	if err := setMDNS(ctx, h, cfg); err != nil {
+		return fmt.Errorf("failed to set up mDNS discovery: %v", err)
+	}
+
+	book, err := setAddressBook(ctx, h, cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to set up address book: %v", err)
+	}
+
+	tracer, err := logging.NewTraceExporter(ctx, h, cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to create pubsub trace exporter: %v", err)
+	}
+
+	ps, blkTopic, txTopic, err := setGossipSub(ctx, h, cfg, bans, book, tracer)
 
 	if err != nil {
 		return fmt.Errorf("failed to create GossipSub: %v", err)
@@ -52,16 +75,34 @@ func InitGeneralNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) e
 
 	user := user.User{
 		Context:        ctx,
+		Config:         cfg,
 		MasterKey:      nil,
 		Chain:          nil,
 		TxTopic:        txTopic,
 		BlockTopic:     blkTopic,
-		MemPool:        mempool.NewMempool(),
+		MemPool:        nil,
 		CurrentPrivKey: nil,
 		CurrentAddress: nil,
 		PeerID:         h.ID(),
+		Host:           h,
+		Bans:           bans,
+		AddressBook:    book,
+		Statuses:       peers.NewStatusBook(),
+		Tracer:         tracer,
+	}
+
+	setMempool(ctx, cfg, &user)
+
+	if err := handler.RegisterValidators(ps, &user); err != nil {
+		return fmt.Errorf("failed to register topic validators: %v", err)
+	} else {
+		log.Infof("topic validators registered successfully")
 	}
 
+	handler.RegisterHandshake(&user)
+	handler.RegisterBlockTxProtocol(&user)
+	handler.RegisterTxRelay(&user)
+
 	cli.CliCommand(&user)
 
 	return nil
@@ -71,7 +112,9 @@ func InitGeneralNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) e
 func InitBootNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) error {
 	log := logger.AppLogger
 
-	h, err := setLibp2pHost(cfg, priv)
+	bans := peers.NewBanList(cfg.Ban.Threshold, cfg.Ban.Duration)
+
+	h, err := setLibp2pHost(cfg, priv, bans)
 
 	logging.InitLogging(h, cfg)
 
@@ -82,13 +125,27 @@ func InitBootNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) erro
 		return fmt.Errorf("failed to create libp2p host: %v", err)
 	}
 
+	bans.SetHost(h)
+
 	// Set up the Kademlia DHT for peer discovery and routing
-	_, err = setKadDHT(ctx, h, cfg)
+	dht, err := setKadDHT(ctx, h, cfg)
 
 	if err != nil {
 		return fmt.Errorf("failed to create Kademlia DHT: %v", err)
 	}
 
+	runDiscovery(ctx, h, dht, cfg)
+
+	if err := setMDNS(ctx, h, cfg); err != nil {
+		return fmt.Errorf("failed to set up mDNS discovery: %v", err)
+	}
+
+	book, err := setAddressBook(ctx, h, cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to set up address book: %v", err)
+	}
+
 	log.Infof("libp2p host, DHT, and GossipSub initialized successfully")
 
 	addrs := make([]string, 0)
@@ -98,5 +155,18 @@ func InitBootNode(ctx context.Context, cfg cfg.Config, priv crypto.PrivKey) erro
 
 	log.Infof("libp2p host listening on %v", addrs)
 
+	// The boot node has no chain, but still answers handshakes so peers can verify it
+	user := user.User{
+		Context:     ctx,
+		Config:      cfg,
+		PeerID:      h.ID(),
+		Host:        h,
+		Bans:        bans,
+		AddressBook: book,
+		Statuses:    peers.NewStatusBook(),
+	}
+
+	handler.RegisterHandshake(&user)
+
 	select {}
 }
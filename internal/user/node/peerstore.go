@@ -0,0 +1,95 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user/peers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// addressBookSaveInterval is how often connected peers are recorded and the address book is written
+const addressBookSaveInterval = time.Minute
+
+// setAddressBook loads the known peers, redials the best of them and keeps the address book up to date
+func setAddressBook(ctx context.Context, h host.Host, cfg cfg.Config) (*peers.AddressBook, error) {
+	log := logger.AppLogger
+
+	ps := cfg.PeerStore
+
+	book, err := peers.NewAddressBook(ps.File, ps.MaxAge, ps.MaxRecords)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load address book: %v", err)
+	} else {
+		log.Infof("address book loaded from %s: %d known peers", ps.File, len(book.Records()))
+	}
+
+	h.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(n network.Network, conn network.Conn) {
+			p := conn.RemotePeer()
+
+			if n.Connectedness(p) != network.Connected {
+				book.Seen(p, h.Peerstore().Addrs(p))
+			}
+		},
+	})
+
+	redialKnownPeers(ctx, h, book, ps.Redial)
+
+	go func() {
+		ticker := time.NewTicker(addressBookSaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// Addresses are recorded after identify, so listen addresses are stored instead of ephemeral ports
+			for _, p := range h.Network().Peers() {
+				book.Seen(p, h.Peerstore().Addrs(p))
+			}
+
+			if err := book.Save(); err != nil {
+				log.Warnf("failed to save address book: %v", err)
+			}
+		}
+	}()
+
+	return book, nil
+}
+
+// redialKnownPeers dials up to n of the best known peers in the background
+func redialKnownPeers(ctx context.Context, h host.Host, book *peers.AddressBook, n int) {
+	log := logger.AppLogger
+
+	for _, r := range book.Best(n) {
+		info := r.AddrInfo()
+
+		if !shouldDial(h, info) {
+			continue
+		}
+
+		h.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.AddressTTL)
+
+		go func(info peer.AddrInfo) {
+			dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+
+			if err := h.Connect(dialCtx, info); err != nil {
+				log.Debugf("failed to redial known peer %s: %v", info.ID, err)
+			} else {
+				log.Infof("reconnected to known peer: %s", info.ID)
+			}
+		}(info)
+	}
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// newPubSub creates the pubsub instance with the configured router
+func newPubSub(ctx context.Context, h host.Host, cfg cfg.Config, opts []pubsub.Option) (*pubsub.PubSub, error) {
+	log := logger.AppLogger
+
+	switch cfg.PubSub.Router {
+	case "gossipsub":
+		params, err := getGossipSubParams(cfg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		gs := cfg.PubSub.GossipSub
+
+		log.Infof("pubsub router: gossipsub, D: %d, Dlo: %d, Dhi: %d, Dlazy: %d, heartbeat: %s, history length: %d, history gossip: %d, flood publish: %t, peer score: %t",
+			params.D, params.Dlo, params.Dhi, params.Dlazy, params.HeartbeatInterval, params.HistoryLength, params.HistoryGossip, *gs.FloodPublish, cfg.PubSub.Score.Enabled)
+
+		opts = append(opts,
+			pubsub.WithGossipSubParams(params),
+			pubsub.WithFloodPublish(*gs.FloodPublish),
+		)
+
+		return pubsub.NewGossipSub(ctx, h, opts...)
+	case "floodsub":
+		log.Infof("pubsub router: floodsub")
+
+		return pubsub.NewFloodSub(ctx, h, opts...)
+	case "randomsub":
+		log.Infof("pubsub router: randomsub, network size: %d", cfg.Network.MaxPeers)
+
+		return pubsub.NewRandomSub(ctx, h, cfg.Network.MaxPeers, opts...)
+	default:
+		return nil, fmt.Errorf("unknown pubsub router: %s", cfg.PubSub.Router)
+	}
+}
+
+// getGossipSubParams builds the gossipsub router parameters from the configuration
+func getGossipSubParams(cfg cfg.Config) (pubsub.GossipSubParams, error) {
+	gs := cfg.PubSub.GossipSub
+	params := pubsub.DefaultGossipSubParams()
+
+	params.D = gs.D
+	params.Dlo = gs.Dlo
+	params.Dhi = gs.Dhi
+	params.Dlazy = gs.Dlazy
+	params.HeartbeatInterval = gs.HeartbeatInterval
+	params.HistoryLength = gs.HistoryLength
+	params.HistoryGossip = gs.HistoryGossip
+
+	if params.Dlo > params.D || params.D > params.Dhi {
+		return params, fmt.Errorf("invalid gossipsub mesh degree: require d_lo <= d <= d_hi, got %d, %d, %d", params.Dlo, params.D, params.Dhi)
+	}
+
+	if params.HistoryGossip > params.HistoryLength {
+		return params, fmt.Errorf("invalid gossipsub history: history_gossip %d exceeds history_length %d", params.HistoryGossip, params.HistoryLength)
+	}
+
+	// Pruning keeps Dscore peers by score, which must fit in the lower mesh bound
+	if params.Dscore > params.Dlo {
+		params.Dscore = params.Dlo
+	}
+
+	if params.Dout >= params.Dlo || params.Dout > params.D/2 {
+		params.Dout = min(params.Dlo-1, params.D/2)
+	}
+
+	return params, nil
+}
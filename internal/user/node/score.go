@@ -0,0 +1,97 @@
+package node
+
+import (
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/cfg"
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/elecbug/lab-chain/internal/user/peers"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// scoreInspectPeriod is how often peer scores are checked against the graylist threshold
+const scoreInspectPeriod = 10 * time.Second
+
+// getPeerScoreParams builds the gossipsub peer score parameters from the configuration
+func getPeerScoreParams(cfg cfg.Config) *pubsub.PeerScoreParams {
+	score := cfg.PubSub.Score
+
+	return &pubsub.PeerScoreParams{
+		Topics: map[string]*pubsub.TopicScoreParams{
+			cfg.Network.Topic("blocks"):       getTopicScoreParams(score.BlockTopicWeight, score.InvalidMessageWeight),
+			cfg.Network.Topic("transactions"): getTopicScoreParams(score.TxTopicWeight, score.InvalidMessageWeight),
+		},
+		TopicScoreCap: 100,
+
+		AppSpecificScore:  func(p peer.ID) float64 { return 0 },
+		AppSpecificWeight: 1,
+
+		IPColocationFactorWeight:    score.IPColocationWeight,
+		IPColocationFactorThreshold: score.IPColocationThreshold,
+
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+
+		DecayInterval: time.Second,
+		DecayToZero:   0.01,
+		RetainScore:   10 * time.Minute,
+	}
+}
+
+// getTopicScoreParams builds the score parameters of a single topic
+func getTopicScoreParams(weight, invalidWeight float64) *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: weight,
+
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Second,
+		TimeInMeshCap:     3600,
+
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+		FirstMessageDeliveriesCap:    100,
+
+		// Mesh delivery penalties are disabled since block and transaction rates are experiment driven
+		MeshMessageDeliveriesWeight:     0,
+		MeshMessageDeliveriesDecay:      pubsub.ScoreParameterDecay(time.Hour),
+		MeshMessageDeliveriesCap:        10,
+		MeshMessageDeliveriesThreshold:  1,
+		MeshMessageDeliveriesWindow:     10 * time.Millisecond,
+		MeshMessageDeliveriesActivation: time.Minute,
+
+		MeshFailurePenaltyWeight: 0,
+		MeshFailurePenaltyDecay:  pubsub.ScoreParameterDecay(time.Hour),
+
+		InvalidMessageDeliveriesWeight: invalidWeight,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
+
+// getPeerScoreThresholds returns the score thresholds for gossip, publishing and graylisting
+func getPeerScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -100,
+		PublishThreshold:            -500,
+		GraylistThreshold:           -1000,
+		AcceptPXThreshold:           10,
+		OpportunisticGraftThreshold: 5,
+	}
+}
+
+// inspectPeerScores returns an inspector that records peer scores and reports graylisted peers to the ban list
+func inspectPeerScores(bans *peers.BanList, book *peers.AddressBook) pubsub.PeerScoreInspectFn {
+	graylist := getPeerScoreThresholds().GraylistThreshold
+
+	return func(scores map[peer.ID]float64) {
+		for p, score := range scores {
+			book.SetScore(p, score)
+
+			if score < graylist {
+				logger.AppLogger.Debugf("peer %s below graylist threshold: %f", p, score)
+				bans.ReportViolation(p, "peer score below graylist threshold")
+			}
+		}
+	}
+}
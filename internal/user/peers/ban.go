@@ -0,0 +1,187 @@
+package peers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elecbug/lab-chain/internal/logger"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Ban describes a banned peer and why it was banned
+type Ban struct {
+	PeerID peer.ID
+	Reason string
+	Until  time.Time
+}
+
+// BanList tracks misbehaving peers and blocks them as a libp2p connection gater
+type BanList struct {
+	mu         sync.RWMutex
+	host       host.Host
+	threshold  int                     // Number of violations before a peer is banned
+	duration   time.Duration           // How long a ban lasts, and how long a violation counts
+	violations map[peer.ID][]time.Time // Times of the violations since the last ban
+	bans       map[peer.ID]*Ban        // Currently banned peers
+}
+
+// NewBanList creates a new ban list with the given violation threshold and ban duration
+func NewBanList(threshold int, duration time.Duration) *BanList {
+	return &BanList{
+		threshold:  threshold,
+		duration:   duration,
+		violations: make(map[peer.ID][]time.Time),
+		bans:       make(map[peer.ID]*Ban),
+	}
+}
+
+// SetHost sets the host used to disconnect banned peers
+func (bl *BanList) SetHost(h host.Host) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	bl.host = h
+}
+
+// ReportViolation records a violation by the peer and bans it once the threshold is reached.
+// Violations expire after the ban duration, so occasional invalid messages never add up to a ban
+func (bl *BanList) ReportViolation(p peer.ID, reason string) {
+	log := logger.AppLogger
+
+	bl.mu.Lock()
+	now := time.Now()
+	recent := bl.violations[p][:0]
+
+	for _, t := range bl.violations[p] {
+		if now.Sub(t) < bl.duration {
+			recent = append(recent, t)
+		}
+	}
+
+	recent = append(recent, now)
+	bl.violations[p] = recent
+	count := len(recent)
+	bl.mu.Unlock()
+
+	log.Infof("violation reported for peer %s (%d/%d): %s", p, count, bl.threshold, reason)
+
+	if count >= bl.threshold {
+		bl.Ban(p, reason)
+	}
+}
+
+// Ban bans the peer for the configured duration and closes its connections
+func (bl *BanList) Ban(p peer.ID, reason string) {
+	log := logger.AppLogger
+
+	bl.mu.Lock()
+	if bl.host != nil && p == bl.host.ID() {
+		bl.mu.Unlock()
+		return
+	}
+
+	bl.bans[p] = &Ban{
+		PeerID: p,
+		Reason: reason,
+		Until:  time.Now().Add(bl.duration),
+	}
+	delete(bl.violations, p)
+	h := bl.host
+	bl.mu.Unlock()
+
+	log.Warnf("peer %s banned for %s: %s", p, bl.duration, reason)
+
+	if h != nil {
+		if err := h.Network().ClosePeer(p); err != nil {
+			log.Warnf("failed to disconnect banned peer %s: %v", p, err)
+		}
+	}
+}
+
+// Unban removes the peer from the ban list and clears its violations
+func (bl *BanList) Unban(p peer.ID) bool {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	_, exists := bl.bans[p]
+
+	delete(bl.bans, p)
+	delete(bl.violations, p)
+
+	return exists
+}
+
+// IsBanned reports whether the peer is currently banned
+func (bl *BanList) IsBanned(p peer.ID) bool {
+	bl.mu.RLock()
+	ban, exists := bl.bans[p]
+	bl.mu.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	if time.Now().After(ban.Until) {
+		bl.mu.Lock()
+		delete(bl.bans, p)
+		bl.mu.Unlock()
+
+		return false
+	}
+
+	return true
+}
+
+// Bans returns the currently banned peers sorted by ban expiry
+func (bl *BanList) Bans() []Ban {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(bl.bans))
+
+	for p, ban := range bl.bans {
+		if now.After(ban.Until) {
+			delete(bl.bans, p)
+			continue
+		}
+
+		bans = append(bans, *ban)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+
+	return bans
+}
+
+// InterceptPeerDial blocks outbound dials to banned peers
+func (bl *BanList) InterceptPeerDial(p peer.ID) bool {
+	return !bl.IsBanned(p)
+}
+
+// InterceptAddrDial blocks outbound dials to any address of banned peers
+func (bl *BanList) InterceptAddrDial(p peer.ID, _ multiaddr.Multiaddr) bool {
+	return !bl.IsBanned(p)
+}
+
+// InterceptAccept accepts all inbound connections, since the peer is not known yet
+func (bl *BanList) InterceptAccept(_ network.ConnMultiaddrs) bool {
+	return true
+}
+
+// InterceptSecured blocks inbound and outbound connections once the banned peer is identified
+func (bl *BanList) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !bl.IsBanned(p)
+}
+
+// InterceptUpgraded accepts all upgraded connections, since banned peers are blocked earlier
+func (bl *BanList) InterceptUpgraded(_ network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,237 @@
+package peers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PeerRecord is a known peer kept across restarts
+type PeerRecord struct {
+	ID       peer.ID   `json:"id"`
+	Addrs    []string  `json:"addrs"`
+	LastSeen time.Time `json:"last_seen"`
+	Score    float64   `json:"score"`  // Latest gossipsub peer score
+	Manual   bool      `json:"manual"` // Added by hand, kept until removed by hand
+}
+
+// AddrInfo returns the peer ID and parsed addresses of the record
+func (r *PeerRecord) AddrInfo() peer.AddrInfo {
+	info := peer.AddrInfo{ID: r.ID}
+
+	for _, a := range r.Addrs {
+		if addr, err := multiaddr.NewMultiaddr(a); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+
+	return info
+}
+
+// AddressBook persists known peers, their addresses, last-seen time and score in a JSON file
+type AddressBook struct {
+	mu         sync.Mutex
+	file       string
+	maxAge     time.Duration // Automatically learned peers not seen for this long are forgotten
+	maxRecords int           // Number of records kept, the worst automatically learned ones are dropped first
+	records    map[peer.ID]*PeerRecord
+}
+
+// NewAddressBook loads the address book from the file, starting empty if it does not exist
+func NewAddressBook(file string, maxAge time.Duration, maxRecords int) (*AddressBook, error) {
+	ab := &AddressBook{
+		file:       file,
+		maxAge:     maxAge,
+		maxRecords: maxRecords,
+		records:    make(map[peer.ID]*PeerRecord),
+	}
+
+	data, err := os.ReadFile(file)
+
+	if os.IsNotExist(err) {
+		return ab, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read address book %s: %v", file, err)
+	}
+
+	var records []*PeerRecord
+
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse address book %s: %v", file, err)
+	}
+
+	for _, r := range records {
+		ab.records[r.ID] = r
+	}
+
+	return ab, nil
+}
+
+// Seen records the peer as seen now at the given addresses
+func (ab *AddressBook) Seen(p peer.ID, addrs []multiaddr.Multiaddr) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	r := ab.records[p]
+
+	if r == nil {
+		r = &PeerRecord{ID: p}
+		ab.records[p] = r
+	}
+
+	if len(addrs) > 0 {
+		r.Addrs = r.Addrs[:0]
+
+		for _, addr := range addrs {
+			r.Addrs = append(r.Addrs, addr.String())
+		}
+	}
+
+	r.LastSeen = time.Now()
+}
+
+// SetScore records the latest score of a known peer
+func (ab *AddressBook) SetScore(p peer.ID, score float64) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	if r := ab.records[p]; r != nil {
+		r.Score = score
+	}
+}
+
+// Add adds or updates a manually curated peer
+func (ab *AddressBook) Add(info peer.AddrInfo) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	r := ab.records[info.ID]
+
+	if r == nil {
+		r = &PeerRecord{ID: info.ID}
+		ab.records[info.ID] = r
+	}
+
+	r.Manual = true
+
+	for _, addr := range info.Addrs {
+		known := false
+
+		for _, a := range r.Addrs {
+			if a == addr.String() {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			r.Addrs = append(r.Addrs, addr.String())
+		}
+	}
+}
+
+// Remove forgets the peer and reports whether it was known
+func (ab *AddressBook) Remove(p peer.ID) bool {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	_, ok := ab.records[p]
+	delete(ab.records, p)
+
+	return ok
+}
+
+// Best returns up to n records, manual peers first, then by score and last-seen time
+func (ab *AddressBook) Best(n int) []PeerRecord {
+	records := ab.Records()
+
+	if len(records) > n {
+		records = records[:n]
+	}
+
+	return records
+}
+
+// Records returns a copy of all records, best first
+func (ab *AddressBook) Records() []PeerRecord {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	return ab.sorted()
+}
+
+// Save prunes stale records and writes the address book to its file
+func (ab *AddressBook) Save() error {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	for p, r := range ab.records {
+		if !r.Manual && ab.maxAge > 0 && time.Since(r.LastSeen) > ab.maxAge {
+			delete(ab.records, p)
+		}
+	}
+
+	records := ab.sorted()
+
+	if ab.maxRecords > 0 && len(records) > ab.maxRecords {
+		for _, r := range records[ab.maxRecords:] {
+			if !r.Manual {
+				delete(ab.records, r.ID)
+			}
+		}
+
+		records = ab.sorted()
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("failed to serialize address book: %v", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated address book
+	tmp := ab.file + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write address book %s: %v", tmp, err)
+	}
+
+	if err := os.Rename(tmp, ab.file); err != nil {
+		return fmt.Errorf("failed to replace address book %s: %v", ab.file, err)
+	}
+
+	return nil
+}
+
+// sorted returns copies of the records, manual peers first, then by score and last-seen time
+func (ab *AddressBook) sorted() []PeerRecord {
+	records := make([]PeerRecord, 0, len(ab.records))
+
+	for _, r := range ab.records {
+		c := *r
+		c.Addrs = append([]string{}, r.Addrs...)
+		records = append(records, c)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+
+		if a.Manual != b.Manual {
+			return a.Manual
+		}
+
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+
+		return a.LastSeen.After(b.LastSeen)
+	})
+
+	return records
+}
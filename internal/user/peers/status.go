@@ -0,0 +1,116 @@
+package peers
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Status is the metadata a node exchanges with its peers in the handshake
+type Status struct {
+	Version     string   `json:"version"`      // Handshake protocol version
+	NetworkID   string   `json:"network_id"`   // Network ID the node belongs to
+	Mode        string   `json:"mode"`         // Node mode, e.g., "full", "light", "boot"
+	GenesisHash []byte   `json:"genesis_hash"` // Hash of the genesis block, empty without a chain
+	HeadHash    []byte   `json:"head_hash"`    // Hash of the last block
+	HeadHeight  uint64   `json:"head_height"`  // Index of the last block
+	TotalWork   *big.Int `json:"total_work"`   // Accumulated proof of work of the chain
+
+	UpdatedAt time.Time `json:"-"` // Time the status was received
+}
+
+// StatusBook records the latest status received from each connected peer
+type StatusBook struct {
+	mu       sync.RWMutex
+	statuses map[peer.ID]*Status
+	lastSync time.Time // Time the last chain request was sent, or is scheduled to be sent
+	syncDue  bool      // Whether a chain request is scheduled and not sent yet
+}
+
+// NewStatusBook creates a new empty status book
+func NewStatusBook() *StatusBook {
+	return &StatusBook{
+		statuses: make(map[peer.ID]*Status),
+	}
+}
+
+// Set records the status of the peer
+func (sb *StatusBook) Set(p peer.ID, status *Status) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	status.UpdatedAt = time.Now()
+	sb.statuses[p] = status
+}
+
+// Get returns the recorded status of the peer, or nil if unknown
+func (sb *StatusBook) Get(p peer.ID) *Status {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	return sb.statuses[p]
+}
+
+// Remove forgets the status of the peer
+func (sb *StatusBook) Remove(p peer.ID) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	delete(sb.statuses, p)
+}
+
+// Best returns the peer with the most accumulated work, or an empty ID if no status is known
+func (sb *StatusBook) Best() (peer.ID, *Status) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	var bestID peer.ID
+	var best *Status
+
+	for p, status := range sb.statuses {
+		if status.TotalWork == nil {
+			continue
+		}
+
+		if best == nil || status.TotalWork.Cmp(best.TotalWork) > 0 {
+			bestID = p
+			best = status
+		}
+	}
+
+	return bestID, best
+}
+
+// ScheduleSync reserves the next chain request at least interval after the previous one and returns how long to wait for it.
+// It returns false if a request is already scheduled, which then also serves the caller
+func (sb *StatusBook) ScheduleSync(interval time.Duration) (time.Duration, bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.syncDue {
+		return 0, false
+	}
+
+	now := time.Now()
+	at := sb.lastSync.Add(interval)
+
+	if at.Before(now) {
+		at = now
+	}
+
+	sb.lastSync = at
+	sb.syncDue = true
+
+	return at.Sub(now), true
+}
+
+// SyncSent marks the scheduled chain request as sent, so the next one can be scheduled
+func (sb *StatusBook) SyncSent() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	sb.lastSync = time.Now()
+	sb.syncDue = false
+}
@@ -3,23 +3,54 @@ package user
 import (
 	"context"
 	"crypto/ecdsa"
+	"sync"
 
+	"github.com/elecbug/lab-chain/internal/cfg"
 	"github.com/elecbug/lab-chain/internal/chain"
+	"github.com/elecbug/lab-chain/internal/logger/logging"
 	"github.com/elecbug/lab-chain/internal/user/mempool"
+	"github.com/elecbug/lab-chain/internal/user/peers"
+	"github.com/elecbug/lab-chain/internal/user/wallet"
 	"github.com/ethereum/go-ethereum/common"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/tyler-smith/go-bip32"
 )
 
 type User struct {
 	Context        context.Context // Context for user operations
+	Config         cfg.Config      // Node configuration
 	MasterKey      *bip32.Key      // BIP-44 master key
+	Wallet         *wallet.Wallet  // Accounts derived from the master key
 	CurrentPrivKey *ecdsa.PrivateKey
 	CurrentAddress *common.Address
-	Chain          *chain.Chain     // Reference to the blockchain
-	TxTopic        *pubsub.Topic    // Pubsub topic for transactions
-	BlockTopic     *pubsub.Topic    // Pubsub topic for blocks
-	MemPool        *mempool.Mempool // Memory pool for transactions
-	PeerID         peer.ID          // Peer ID of the user in the network
+	Chain          *chain.Chain           // Reference to the blockchain, set with SetChain and read with GetChain outside the CLI
+	TxTopic        *pubsub.Topic          // Pubsub topic for transactions
+	BlockTopic     *pubsub.Topic          // Pubsub topic for blocks
+	MemPool        *mempool.Mempool       // Memory pool for transactions
+	PeerID         peer.ID                // Peer ID of the user in the network
+	Host           host.Host              // libp2p host of the node
+	Bans           *peers.BanList         // Ban list of misbehaving peers
+	AddressBook    *peers.AddressBook     // Known peers persisted across restarts
+	Statuses       *peers.StatusBook      // Latest handshake status of connected peers
+	Tracer         *logging.TraceExporter // Pubsub trace exporter correlating messages to blocks and transactions
+
+	chainMu sync.RWMutex // Guards the Chain reference, which the CLI sets while network handlers read it
+}
+
+// GetChain returns the blockchain of the user, or nil if it is not initialized yet
+func (user *User) GetChain() *chain.Chain {
+	user.chainMu.RLock()
+	defer user.chainMu.RUnlock()
+
+	return user.Chain
+}
+
+// SetChain sets the blockchain of the user
+func (user *User) SetChain(c *chain.Chain) {
+	user.chainMu.Lock()
+	defer user.chainMu.Unlock()
+
+	user.Chain = c
 }
@@ -0,0 +1,168 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/tyler-smith/go-bip32"
+)
+
+// DerivationPath is a BIP-44 path m/44'/60'/account'/change/index
+type DerivationPath struct {
+	Account uint32
+	Change  uint32
+	Index   uint32
+}
+
+// DefaultPath returns the path of the address index in the first account
+func DefaultPath(index uint32) DerivationPath {
+	return DerivationPath{Account: 0, Change: 0, Index: index}
+}
+
+// ParsePath parses a path of the form m/44'/60'/account'/change/index, where h may be used instead of '
+func ParsePath(s string) (DerivationPath, error) {
+	parts := strings.Split(strings.ReplaceAll(s, "h", "'"), "/")
+
+	if len(parts) != 6 || parts[0] != "m" || parts[1] != "44'" || parts[2] != "60'" {
+		return DerivationPath{}, fmt.Errorf("invalid path %s, expected m/44'/60'/account'/change/index", s)
+	}
+
+	if !strings.HasSuffix(parts[3], "'") || strings.HasSuffix(parts[4], "'") || strings.HasSuffix(parts[5], "'") {
+		return DerivationPath{}, fmt.Errorf("invalid path %s, only the account level is hardened", s)
+	}
+
+	var values [3]uint32
+
+	for i, part := range []string{strings.TrimSuffix(parts[3], "'"), parts[4], parts[5]} {
+		v, err := strconv.ParseUint(part, 10, 31)
+
+		if err != nil {
+			return DerivationPath{}, fmt.Errorf("invalid path %s: %v", s, err)
+		}
+
+		values[i] = uint32(v)
+	}
+
+	return DerivationPath{Account: values[0], Change: values[1], Index: values[2]}, nil
+}
+
+// String returns the path in the form m/44'/60'/account'/change/index
+func (p DerivationPath) String() string {
+	return fmt.Sprintf("m/44'/60'/%d'/%d/%d", p.Account, p.Change, p.Index)
+}
+
+// children returns the child numbers of the path from the master key
+func (p DerivationPath) children() []uint32 {
+	return []uint32{
+		44 + bip32.FirstHardenedChild,
+		60 + bip32.FirstHardenedChild,
+		p.Account + bip32.FirstHardenedChild,
+		p.Change,
+		p.Index,
+	}
+}
+
+// Account is an address derived from the master key
+type Account struct {
+	Label   string
+	Path    DerivationPath
+	Address common.Address
+	PrivKey *ecdsa.PrivateKey
+}
+
+// Wallet tracks the accounts derived from a master key in the order they were derived
+type Wallet struct {
+	masterKey *bip32.Key
+	accounts  []*Account
+}
+
+// NewWallet creates a wallet without accounts for the master key
+func NewWallet(masterKey *bip32.Key) *Wallet {
+	return &Wallet{
+		masterKey: masterKey,
+		accounts:  nil,
+	}
+}
+
+// Derive returns the account at the path, deriving and tracking it if it is new.
+// A non-empty label is assigned to the account and must not be used by another one
+func (w *Wallet) Derive(path DerivationPath, label string) (*Account, error) {
+	if label != "" {
+		if _, err := strconv.Atoi(label); err == nil {
+			return nil, fmt.Errorf("label must not be a number: %s", label)
+		}
+
+		if other := w.byLabel(label); other != nil && other.Path != path {
+			return nil, fmt.Errorf("label already used by %s", other.Path)
+		}
+	}
+
+	for _, a := range w.accounts {
+		if a.Path == path {
+			if label != "" {
+				a.Label = label
+			}
+
+			return a, nil
+		}
+	}
+
+	priv, addr, err := GenerateAddress(w.masterKey, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Account{
+		Label:   label,
+		Path:    path,
+		Address: *addr,
+		PrivKey: priv,
+	}
+
+	w.accounts = append(w.accounts, a)
+
+	return a, nil
+}
+
+// Accounts returns the tracked accounts in the order they were derived
+func (w *Wallet) Accounts() []*Account {
+	return append([]*Account{}, w.accounts...)
+}
+
+// Find returns the account with the label or, failing that, at the position in the account list
+func (w *Wallet) Find(ref string) (*Account, error) {
+	if a := w.byLabel(ref); a != nil {
+		return a, nil
+	}
+
+	i, err := strconv.Atoi(ref)
+
+	if err != nil {
+		return nil, fmt.Errorf("no account labeled %s", ref)
+	}
+
+	if i < 0 || i >= len(w.accounts) {
+		return nil, fmt.Errorf("no account at position %d", i)
+	}
+
+	return w.accounts[i], nil
+}
+
+// byLabel returns the account with the label, or nil
+func (w *Wallet) byLabel(label string) *Account {
+	if label == "" {
+		return nil
+	}
+
+	for _, a := range w.accounts {
+		if a.Label == label {
+			return a
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt parameters of new keystores, about 32 MiB of memory per derivation
+const (
+	keystoreScryptN     = 1 << 15
+	keystoreScryptR     = 8
+	keystoreScryptP     = 1
+	keystoreScryptDKLen = 32
+)
+
+// keystoreVersion is the version of the keystore format
+const keystoreVersion = 1
+
+// Keystore is an encrypted secret in a format similar to the Ethereum v3 keystore,
+// using scrypt to derive the key and AES-256-GCM to encrypt and authenticate the secret
+type Keystore struct {
+	Version int            `json:"version"`
+	Crypto  KeystoreCrypto `json:"crypto"`
+}
+
+// KeystoreCrypto holds the cipher and key derivation parameters of a keystore
+type KeystoreCrypto struct {
+	Cipher       string         `json:"cipher"`
+	CipherText   string         `json:"ciphertext"`
+	CipherParams CipherParams   `json:"cipherparams"`
+	KDF          string         `json:"kdf"`
+	KDFParams    ScryptKDFParam `json:"kdfparams"`
+}
+
+// CipherParams holds the nonce of the authenticated encryption
+type CipherParams struct {
+	Nonce string `json:"nonce"`
+}
+
+// ScryptKDFParam holds the scrypt parameters used to derive the encryption key from the passphrase
+type ScryptKDFParam struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKeystore encrypts the secret with a key derived from the passphrase
+func EncryptKeystore(secret []byte, passphrase string) (*Keystore, error) {
+	salt := make([]byte, 32)
+
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	params := ScryptKDFParam{
+		N:     keystoreScryptN,
+		R:     keystoreScryptR,
+		P:     keystoreScryptP,
+		DKLen: keystoreScryptDKLen,
+		Salt:  hex.EncodeToString(salt),
+	}
+
+	gcm, err := keystoreCipher(passphrase, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return &Keystore{
+		Version: keystoreVersion,
+		Crypto: KeystoreCrypto{
+			Cipher:       "aes-256-gcm",
+			CipherText:   hex.EncodeToString(gcm.Seal(nil, nonce, secret, nil)),
+			CipherParams: CipherParams{Nonce: hex.EncodeToString(nonce)},
+			KDF:          "scrypt",
+			KDFParams:    params,
+		},
+	}, nil
+}
+
+// Decrypt returns the secret of the keystore, failing if the passphrase is wrong or the keystore was modified
+func (ks *Keystore) Decrypt(passphrase string) ([]byte, error) {
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version: %d", ks.Version)
+	}
+
+	if ks.Crypto.Cipher != "aes-256-gcm" || ks.Crypto.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore cipher %s or kdf %s", ks.Crypto.Cipher, ks.Crypto.KDF)
+	}
+
+	params := ks.Crypto.KDFParams
+
+	// Only the parameters written by EncryptKeystore are accepted, so a crafted file cannot demand unbounded memory or time
+	if params.N != keystoreScryptN || params.R != keystoreScryptR || params.P != keystoreScryptP {
+		return nil, fmt.Errorf("unsupported keystore scrypt parameters: n %d, r %d, p %d", params.N, params.R, params.P)
+	}
+
+	if params.DKLen != keystoreScryptDKLen {
+		return nil, fmt.Errorf("invalid keystore key length: %d", params.DKLen)
+	}
+
+	gcm, err := keystoreCipher(passphrase, params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(ks.Crypto.CipherParams.Nonce)
+
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid keystore nonce")
+	}
+
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore ciphertext: %v", err)
+	}
+
+	secret, err := gcm.Open(nil, nonce, cipherText, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted keystore")
+	}
+
+	return secret, nil
+}
+
+// keystoreCipher derives the key from the passphrase and returns the AES-GCM cipher
+func keystoreCipher(passphrase string, params ScryptKDFParam) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(params.Salt)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt: %v", err)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DKLen)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// parseKeystore parses a keystore file, reporting whether the data is a keystore at all
+func parseKeystore(data []byte) (*Keystore, bool, error) {
+	var ks Keystore
+
+	if !json.Valid(data) {
+		return nil, false, nil
+	}
+
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, true, fmt.Errorf("failed to parse keystore: %v", err)
+	}
+
+	return &ks, true, nil
+}
@@ -2,8 +2,10 @@ package wallet
 
 import (
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/elecbug/lab-chain/internal/logger"
 	"github.com/ethereum/go-ethereum/common"
@@ -12,27 +14,53 @@ import (
 	"github.com/tyler-smith/go-bip39"
 )
 
-// GenerateMasterKey generates a BIP-44 master key and returns it
-func GenerateMasterKey() (*bip32.Key, error) {
+// GenerateMasterKey generates a BIP-44 master key from a new mnemonic of the given number of words
+// and the BIP-39 passphrase, and returns it with the mnemonic.
+// The mnemonic is never logged, so the caller has to show it to the user
+func GenerateMasterKey(words int, passphrase string) (*bip32.Key, string, error) {
 	log := logger.AppLogger
 
-	log.Infof("generating BIP-44 mnemonic")
+	if words < 12 || words > 24 || words%3 != 0 {
+		return nil, "", fmt.Errorf("invalid number of mnemonic words: %d, expected 12, 15, 18, 21 or 24", words)
+	}
+
+	log.Infof("generating BIP-44 mnemonic with %d words", words)
 
-	entropy, err := bip39.NewEntropy(128)
+	// Every 3 words encode 32 bits of entropy and 1 checksum bit
+	entropy, err := bip39.NewEntropy(words / 3 * 32)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate entropy: %v", err)
+		return nil, "", fmt.Errorf("failed to generate entropy: %v", err)
 	}
 
 	mnemonic, err := bip39.NewMnemonic(entropy)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate mnemonic: %v", err)
+		return nil, "", fmt.Errorf("failed to generate mnemonic: %v", err)
 	} else {
-		log.Infof("generated mnemonic: %s", mnemonic)
+		log.Infof("mnemonic generated successfully")
 	}
 
-	seed := bip39.NewSeed(mnemonic, "")
+	masterKey, err := RestoreMasterKey(mnemonic, passphrase)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return masterKey, mnemonic, nil
+}
+
+// RestoreMasterKey rebuilds the master key from a mnemonic, validating its checksum, and the BIP-39 passphrase
+func RestoreMasterKey(mnemonic string, passphrase string) (*bip32.Key, error) {
+	log := logger.AppLogger
+
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %v", err)
+	}
 
 	masterKey, err := bip32.NewMasterKey(seed)
 
@@ -45,13 +73,23 @@ func GenerateMasterKey() (*bip32.Key, error) {
 	return masterKey, nil
 }
 
-// SaveMasterKey saves the master key to a file
-func SaveMasterKey(file string, masterKey *bip32.Key) error {
+// SaveMasterKey saves the master key to a keystore file encrypted with the passphrase
+func SaveMasterKey(file string, masterKey *bip32.Key, passphrase string) error {
 	log := logger.AppLogger
 
-	serialized := masterKey.String()
+	ks, err := EncryptKeystore([]byte(masterKey.String()), passphrase)
+
+	if err != nil {
+		return fmt.Errorf("failed to encrypt master key: %v", err)
+	}
 
-	if err := os.WriteFile(file, []byte(serialized), 0600); err != nil {
+	data, err := json.MarshalIndent(ks, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("failed to serialize keystore: %v", err)
+	}
+
+	if err := os.WriteFile(file, data, 0600); err != nil {
 		return fmt.Errorf("failed to save master key: %v", err)
 	} else {
 		log.Infof("master key saved to file successfully")
@@ -60,8 +98,9 @@ func SaveMasterKey(file string, masterKey *bip32.Key) error {
 	return nil
 }
 
-// LoadMasterKey loads the master key from a file
-func LoadMasterKey(file string) (*bip32.Key, error) {
+// LoadMasterKey loads the master key from a keystore file encrypted with the passphrase.
+// Plain files written by earlier versions are still accepted
+func LoadMasterKey(file string, passphrase string) (*bip32.Key, error) {
 	log := logger.AppLogger
 
 	data, err := os.ReadFile(file)
@@ -70,7 +109,23 @@ func LoadMasterKey(file string) (*bip32.Key, error) {
 		return nil, fmt.Errorf("failed to read master key file: %v", err)
 	}
 
-	loadedKey, err := bip32.B58Deserialize(string(data))
+	ks, isKeystore, err := parseKeystore(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isKeystore {
+		data, err = ks.Decrypt(passphrase)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt master key: %v", err)
+		}
+	} else {
+		log.Warnf("master key file %s is not encrypted, save it again to encrypt it", file)
+	}
+
+	loadedKey, err := bip32.B58Deserialize(strings.TrimSpace(string(data)))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to deserialize master key: %v", err)
@@ -81,22 +136,28 @@ func LoadMasterKey(file string) (*bip32.Key, error) {
 	return loadedKey, nil
 }
 
-// GenerateAddress generates a BIP-44 key pair for the specified index
-func GenerateAddress(masterKey *bip32.Key, index int) (*ecdsa.PrivateKey, *common.Address, error) {
+// GenerateAddress generates the BIP-44 key pair at the derivation path
+func GenerateAddress(masterKey *bip32.Key, path DerivationPath) (*ecdsa.PrivateKey, *common.Address, error) {
 	log := logger.AppLogger
 
-	purpose, _ := masterKey.NewChildKey(44 + bip32.FirstHardenedChild)
-	coinType, _ := purpose.NewChildKey(60 + bip32.FirstHardenedChild)
-	account, _ := coinType.NewChildKey(0 + bip32.FirstHardenedChild)
-	change, _ := account.NewChildKey(0)
-	addressKey, _ := change.NewChildKey(uint32(index))
+	key := masterKey
+
+	for _, child := range path.children() {
+		next, err := key.NewChildKey(child)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to derive %s: %v", path, err)
+		}
+
+		key = next
+	}
 
-	privateKey, err := crypto.ToECDSA(addressKey.Key)
+	privateKey, err := crypto.ToECDSA(key.Key)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to convert to ECDSA: %v", err)
 	} else {
-		log.Infof("private key generated successfully")
+		log.Infof("private key generated successfully: %s", path)
 	}
 
 	publicKey := privateKey.Public().(*ecdsa.PublicKey)
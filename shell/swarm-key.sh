@@ -0,0 +1,2 @@
+printf "/key/swarm/psk/1.0.0/\n/base16/\n" > $1
+head -c 32 /dev/urandom | od -t x1 -A none - | tr -d "\n " >> $1